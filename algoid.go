@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrAlgoIDRejected 表示门户不接受当前的AlgoID：算法协商的响应无法解析、协商出未知的算法，
+// 或者ticket的响应无法用协商的算法解密/解析。只有这类错误和门户返回的拒绝码才换下一个AlgoID重试
+var ErrAlgoIDRejected = errors.New("algo id rejected")
+
+// validateAlgoIDs 检查 algo_ids 中的算法都是已知的
+func validateAlgoIDs(ids []string) error {
+	for _, id := range ids {
+		if id != DefaultAlgoID && NewCipher(id) == nil {
+			return errors.New("unknown algo id: " + id)
+		}
+	}
+	return nil
+}
+
+// algoIDCandidates 返回获取ticket时依次尝试的AlgoID：上次成功的、默认的全零ID、algo_ids 配置的，
+// 未配置 algo_ids 时最后尝试所有已知的算法
+func (e *ESurfing) algoIDCandidates() []string {
+	candidates := []string{}
+	add := func(id string) {
+		if id != "" && !slices.Contains(candidates, id) {
+			candidates = append(candidates, id)
+		}
+	}
+
+	add(e.loadAlgoID())
+	add(DefaultAlgoID)
+	for _, id := range e.Config.AlgoIDs {
+		add(id)
+	}
+	if len(e.Config.AlgoIDs) == 0 {
+		known := make([]string, 0, len(cipherRegistry))
+		for id := range cipherRegistry {
+			known = append(known, id)
+		}
+		slices.Sort(known)
+		for _, id := range known {
+			add(id)
+		}
+	}
+	return candidates
+}
+
+// negotiateTicket 协商加密算法并获取ticket。门户拒绝当前的AlgoID或ticket请求时换下一个候选重试，
+// 其他错误(网络、HTTP状态、取消等)换算法也无济于事，直接返回；成功的AlgoID记录下来，下次启动优先使用
+func (e *ESurfing) negotiateTicket() error {
+	var err error
+	for i, algoID := range e.algoIDCandidates() {
+		if i > 0 {
+			e.Log.Printf(T("ticket rejected, retry with algo_id %s: %v"), algoID, err)
+		}
+
+		e.AlgoID = algoID
+		err = e.Traced("algo_id", e.GetAlgoId)
+		if err == nil {
+			e.cipher = NewCipher(e.AlgoID)
+			if e.cipher == nil {
+				err = fmt.Errorf("%w: unknown AlgoID %s", ErrAlgoIDRejected, e.AlgoID)
+			}
+		}
+		if err == nil {
+			e.Log.Println(T("algo_id:"), e.AlgoID)
+			err = e.Traced("ticket", e.GetTicket)
+		}
+		if err == nil {
+			if algoID != e.loadAlgoID() && (i > 0 || algoID != DefaultAlgoID) {
+				e.saveAlgoID(algoID)
+			}
+			return nil
+		}
+
+		if e.requestContext().Err() != nil || !algoIDRejected(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// algoIDRejected 判断获取ticket的错误是否说明应该换一个AlgoID
+func algoIDRejected(err error) bool {
+	var portalErr *PortalError
+	return errors.Is(err, ErrAlgoIDRejected) || errors.Is(err, ErrDecryptResponse) || errors.As(err, &portalErr)
+}
+
+func (e *ESurfing) loadAlgoID() string {
+	if id := e.loadState().AlgoID; id == DefaultAlgoID || NewCipher(id) != nil {
+		return id
+	}
+	return ""
+}
+
+func (e *ESurfing) saveAlgoID(algoID string) {
+	if err := e.updateState(func(s *AccountState) { s.AlgoID = algoID }); err != nil {
+		e.Log.Printf(T("save algo id error: %v"), err)
+		return
+	}
+	e.Log.Printf(T("algo_id %s saved to %s"), algoID, statePath())
+}
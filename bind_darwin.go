@@ -0,0 +1,48 @@
+//go:build darwin
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// bindControl 使用 IP_BOUND_IF 将连接限定在指定网卡上，Wi-Fi和有线同时接入时
+// 仅绑定源地址并不能阻止系统从默认网卡发出
+func bindControl(c *Config) (func(network, address string, conn syscall.RawConn) error, error) {
+	if c.VRF != "" {
+		return nil, errors.New("vrf is only supported on linux")
+	}
+	if !c.BindToDevice {
+		return nil, nil
+	}
+	if c.BindInterface == "" {
+		return nil, errors.New("bind_to_device requires bind_interface")
+	}
+
+	iFace, err := net.InterfaceByName(c.BindInterface)
+	if err != nil {
+		return nil, fmt.Errorf("bind device %s: %v", c.BindInterface, err)
+	}
+
+	return func(network, address string, conn syscall.RawConn) error {
+		var sockErr error
+		err := conn.Control(func(fd uintptr) {
+			if strings.HasSuffix(network, "6") {
+				sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_BOUND_IF, iFace.Index)
+				return
+			}
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_BOUND_IF, iFace.Index)
+		})
+		if err != nil {
+			return err
+		}
+		if sockErr != nil {
+			return fmt.Errorf("IP_BOUND_IF %s: %w", c.BindInterface, sockErr)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,46 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// bindControl 使用 SO_BINDTODEVICE 将连接绑定到网卡或VRF设备，
+// 这样即使策略路由会把流量送往其他出口，门户请求也只走指定设备的路由表
+func bindControl(c *Config) (func(network, address string, conn syscall.RawConn) error, error) {
+	device := ""
+	if c.BindToDevice {
+		if c.BindInterface == "" {
+			return nil, errors.New("bind_to_device requires bind_interface")
+		}
+		device = c.BindInterface
+	}
+	if device == "" && c.VRF != "" {
+		device = c.VRF
+	}
+	if device == "" {
+		return nil, nil
+	}
+
+	if _, err := net.InterfaceByName(device); err != nil {
+		return nil, fmt.Errorf("bind device %s: %v", device, err)
+	}
+
+	return func(network, address string, conn syscall.RawConn) error {
+		var sockErr error
+		err := conn.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, device)
+		})
+		if err != nil {
+			return err
+		}
+		if sockErr != nil {
+			return fmt.Errorf("SO_BINDTODEVICE %s: %w", device, sockErr)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !windows && !darwin
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+func bindControl(c *Config) (func(network, address string, conn syscall.RawConn) error, error) {
+	if c.BindToDevice || c.VRF != "" {
+		return nil, errors.New("bind_to_device and vrf are not supported on this platform")
+	}
+	return nil, nil
+}
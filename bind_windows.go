@@ -0,0 +1,57 @@
+//go:build windows
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+)
+
+const (
+	ipUnicastIf   = 31
+	ipv6UnicastIf = 31
+)
+
+// bindControl 使用 IP_UNICASTIF 将连接固定到指定网卡，多网卡的Windows主机上
+// 仅绑定源地址时系统仍可能按路由表从其他网卡发出
+func bindControl(c *Config) (func(network, address string, conn syscall.RawConn) error, error) {
+	if c.VRF != "" {
+		return nil, errors.New("vrf is only supported on linux")
+	}
+	if !c.BindToDevice {
+		return nil, nil
+	}
+	if c.BindInterface == "" {
+		return nil, errors.New("bind_to_device requires bind_interface")
+	}
+
+	iFace, err := net.InterfaceByName(c.BindInterface)
+	if err != nil {
+		return nil, fmt.Errorf("bind device %s: %v", c.BindInterface, err)
+	}
+
+	return func(network, address string, conn syscall.RawConn) error {
+		var sockErr error
+		err := conn.Control(func(fd uintptr) {
+			if strings.HasSuffix(network, "6") {
+				sockErr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IPV6, ipv6UnicastIf, iFace.Index)
+				return
+			}
+			// IPv4 的 IP_UNICASTIF 要求网络字节序的网卡索引
+			var index [4]byte
+			binary.BigEndian.PutUint32(index[:], uint32(iFace.Index))
+			sockErr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, ipUnicastIf, int(binary.LittleEndian.Uint32(index[:])))
+		})
+		if err != nil {
+			return err
+		}
+		if sockErr != nil {
+			return fmt.Errorf("IP_UNICASTIF %s: %w", c.BindInterface, sockErr)
+		}
+		return nil
+	}, nil
+}
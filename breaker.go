@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"time"
+)
+
+// CircuitBreakerConfig 配置门户请求的熔断。最近 window 次认证/保活中失败的比例达到 failure_rate 时熔断：
+// 停止检测、认证和保活，改为每隔 open_interval 请求一次 probe_url，能访问后才恢复完整的认证，
+// 避免AC重启期间刷屏日志或因连续失败被锁定账号
+type CircuitBreakerConfig struct {
+	FailureRate  float64 `json:"failure_rate"`
+	Window       int     `json:"window"`
+	MinCalls     int     `json:"min_calls"`
+	OpenInterval int     `json:"open_interval"`
+	ProbeURL     string  `json:"probe_url"`
+}
+
+func (b *CircuitBreakerConfig) validate() error {
+	if b.FailureRate == 0 {
+		b.FailureRate = 0.5
+	}
+	if b.FailureRate < 0 || b.FailureRate > 1 {
+		return errors.New("circuit breaker failure_rate must be between 0 and 1")
+	}
+	if b.Window <= 0 {
+		b.Window = 10
+	}
+	if b.MinCalls <= 0 {
+		b.MinCalls = min(5, b.Window)
+	}
+	if b.MinCalls > b.Window {
+		return errors.New("circuit breaker min_calls is larger than window")
+	}
+	if b.OpenInterval <= 0 {
+		b.OpenInterval = 300000
+	}
+	if b.ProbeURL != "" {
+		parsed, err := url.Parse(b.ProbeURL)
+		if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return errors.New("invalid circuit breaker probe_url: " + b.ProbeURL)
+		}
+	}
+	return nil
+}
+
+// circuitBreaker 只在客户端自己的 goroutine 中使用，状态变化同步到 status.CircuitOpen
+type circuitBreaker struct {
+	cfg *CircuitBreakerConfig
+	// failures 按时间顺序记录最近的调用是否失败，最多 Window 个
+	failures  []bool
+	open      bool
+	halfOpen  bool
+	nextProbe time.Time
+	// portalBase 是最近一次认证的门户根地址，未配置 probe_url 时用来探测
+	portalBase string
+}
+
+func (b *circuitBreaker) failureCount() int {
+	n := 0
+	for _, failed := range b.failures {
+		if failed {
+			n++
+		}
+	}
+	return n
+}
+
+// recordPortalCall 记录一次认证或保活的结果，返回熔断器此时是否断开。
+// 取消和维护公告不计入，维护由 maintenance_interval 单独处理
+func (c *Client) recordPortalCall(err error) bool {
+	b := c.breaker
+	if b == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrMaintenance) {
+		return false
+	}
+	if b.open {
+		return true
+	}
+
+	if b.halfOpen {
+		if err == nil {
+			b.halfOpen = false
+			c.Log.Println(T("portal recovered, circuit closed"))
+			return false
+		}
+		c.openCircuit(err)
+		b.halfOpen = false
+		return true
+	}
+
+	b.failures = append(b.failures, err != nil)
+	if len(b.failures) > b.cfg.Window {
+		b.failures = b.failures[len(b.failures)-b.cfg.Window:]
+	}
+	if err == nil || len(b.failures) < b.cfg.MinCalls {
+		return false
+	}
+	if float64(b.failureCount()) < b.cfg.FailureRate*float64(len(b.failures)) {
+		return false
+	}
+	c.openCircuit(err)
+	return true
+}
+
+func (c *Client) openCircuit(err error) {
+	b := c.breaker
+	interval := time.Millisecond * time.Duration(b.cfg.OpenInterval)
+	if b.halfOpen {
+		c.Log.Printf(T("portal still failing after recovery, circuit open again, probing every %v: %v"), interval, err)
+	} else {
+		c.Log.Printf(T("portal failing (%d of last %d calls), circuit open, probing every %v: %v"),
+			b.failureCount(), len(b.failures), interval, err)
+	}
+
+	b.open = true
+	b.failures = nil
+	b.nextProbe = time.Now().Add(interval)
+	c.stopHeartbeat()
+	c.setCircuitOpen(true)
+	c.emitError(EventCircuitOpen, err)
+}
+
+// breakerAllow 返回现在是否可以检测和认证。熔断期间到了探测时间才请求一次 probe_url，
+// 能够访问时进入半开状态，放行一次完整的认证，认证结果决定是否恢复
+func (c *Client) breakerAllow() bool {
+	b := c.breaker
+	if b == nil || !b.open {
+		return true
+	}
+	if time.Now().Before(b.nextProbe) {
+		return false
+	}
+
+	probeURL := b.cfg.ProbeURL
+	if probeURL == "" {
+		probeURL = b.portalBase
+	}
+	if probeURL != "" {
+		if err := c.probePortal(probeURL); err != nil {
+			b.nextProbe = time.Now().Add(time.Millisecond * time.Duration(b.cfg.OpenInterval))
+			c.Log.Printf(T("portal still unreachable, next probe at %s: %v"), b.nextProbe.Format(time.TimeOnly), err)
+			return false
+		}
+	}
+
+	c.Log.Println(T("portal reachable again, trying a full authentication"))
+	b.open = false
+	b.halfOpen = true
+	c.setCircuitOpen(false)
+	return true
+}
+
+// probePortal 发送一次不重试的GET请求，收到非5xx的响应即认为门户已恢复
+func (c *Client) probePortal(probeURL string) error {
+	request, err := c.NewGetRequest(probeURL)
+	if err != nil {
+		return err
+	}
+	response, err := c.HttpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+	_ = response.Body.Close()
+	if response.StatusCode >= 500 {
+		return errors.New("unexpected status " + response.Status)
+	}
+	return nil
+}
+
+// notePortalBase 记录门户的根地址，供熔断期间探测
+func (c *Client) notePortalBase(portalURL string) {
+	if c.breaker == nil {
+		return
+	}
+	if parsed, err := url.Parse(portalURL); err == nil && parsed.Host != "" {
+		c.breaker.portalBase = parsed.Scheme + "://" + parsed.Host + "/"
+	}
+}
+
+// resetBreaker 在 relogin 命令时清除熔断状态，立即恢复认证
+func (c *Client) resetBreaker() {
+	if c.breaker == nil {
+		return
+	}
+	c.breaker.open, c.breaker.halfOpen, c.breaker.failures = false, false, nil
+	c.setCircuitOpen(false)
+}
+
+func (c *Client) setCircuitOpen(open bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.CircuitOpen = open
+}
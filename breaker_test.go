@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newBreakerClient(t *testing.T) *Client {
+	t.Helper()
+	cfg := &CircuitBreakerConfig{FailureRate: 0.5, Window: 4, MinCalls: 2}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return newTestClient(t, &Config{CircuitBreaker: cfg})
+}
+
+func TestRecordPortalCall(t *testing.T) {
+	c := newBreakerClient(t)
+	failure := errors.New("portal unreachable")
+
+	if c.recordPortalCall(failure) {
+		t.Fatal("opened below min_calls")
+	}
+	if c.recordPortalCall(context.Canceled) || c.recordPortalCall(fmt.Errorf("notice: %w", ErrMaintenance)) {
+		t.Fatal("cancellation or maintenance counted as a failure")
+	}
+	if len(c.breaker.failures) != 1 {
+		t.Fatalf("recorded %d calls, want 1", len(c.breaker.failures))
+	}
+	if c.recordPortalCall(nil) {
+		t.Fatal("a success opened the circuit")
+	}
+	if !c.recordPortalCall(failure) {
+		t.Fatal("2 of 3 calls failed, want the circuit open")
+	}
+	if !c.Status().CircuitOpen {
+		t.Error("status does not show the open circuit")
+	}
+	if !c.recordPortalCall(nil) {
+		t.Error("an open circuit closed without a probe")
+	}
+}
+
+func TestRecordPortalCallHalfOpen(t *testing.T) {
+	for _, test := range []struct {
+		err      error
+		wantOpen bool
+	}{
+		{nil, false},
+		{errors.New("still failing"), true},
+	} {
+		c := newBreakerClient(t)
+		c.openCircuit(errors.New("portal unreachable"))
+		c.breaker.nextProbe = time.Now().Add(-time.Second)
+
+		if !c.breakerAllow() || !c.breaker.halfOpen {
+			t.Fatal("breaker did not let a trial authentication through after the probe time")
+		}
+		if open := c.recordPortalCall(test.err); open != test.wantOpen || c.breaker.open != test.wantOpen {
+			t.Errorf("after trial with err %v: open = %v, want %v", test.err, open, test.wantOpen)
+		}
+		if c.breaker.halfOpen {
+			t.Error("still half open after the trial authentication")
+		}
+	}
+}
+
+func TestHandleRedirectSkipsLatencyWhileOpen(t *testing.T) {
+	c := newBreakerClient(t)
+	c.portal = &countingPortal{}
+	c.openCircuit(errors.New("portal unreachable"))
+
+	if err := c.HandleRedirect("http://portal.example/"); err != nil {
+		t.Fatal(err)
+	}
+	if authLatency, _ := c.histograms(); authLatency.Count != 0 {
+		t.Errorf("auth latency observed %d times while the circuit was open", authLatency.Count)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	CarrierTelecom = "telecom"
+	CarrierCMCC    = "cmcc"
+	CarrierUnicom  = "unicom"
+)
+
+// CarrierProfile 描述移动/联通网页门户之间不同的接口路径和参数名
+type CarrierProfile struct {
+	LoginPath string
+	// KeepPath 保活地址，只有天翼校园网页认证(WebPortal)使用；移动/联通门户没有公开的保活接口
+	KeepPath      string
+	LogoutPath    string
+	UserParam     string
+	PasswordParam string
+	UserIPParam   string
+	AcIPParam     string
+	AcNameParam   string
+	Extra         map[string]string
+	SuccessMarks  []string
+}
+
+var carrierProfiles = map[string]*CarrierProfile{
+	CarrierCMCC: {
+		LoginPath:     "/portal/login",
+		LogoutPath:    "/portal/logout",
+		UserParam:     "username",
+		PasswordParam: "password",
+		UserIPParam:   "wlanuserip",
+		AcIPParam:     "wlanacip",
+		AcNameParam:   "wlanacname",
+		Extra:         map[string]string{"loginmode": "static", "actiontype": "LOGIN"},
+		SuccessMarks:  []string{"\"result\":\"success\"", "\"result\":1", "login_ok"},
+	},
+	CarrierUnicom: {
+		LoginPath:     "/portal/pws?t=li",
+		LogoutPath:    "/portal/pws?t=lo",
+		UserParam:     "userName",
+		PasswordParam: "userPwd",
+		UserIPParam:   "userip",
+		AcIPParam:     "nasip",
+		AcNameParam:   "basname",
+		Extra:         map[string]string{"serviceType": "", "isSavePwd": "off"},
+		SuccessMarks:  []string{"\"portServIncludeFailedCode\":\"\"", "\"result\":\"success\"", "login_ok"},
+	},
+}
+
+// 不同网关在重定向地址中使用的参数名
+var (
+	redirectUserIPKeys = []string{"wlanuserip", "userip", "UserIP", "user_ip", "ip"}
+	redirectAcIPKeys   = []string{"wlanacip", "nasip", "acip", "ac_ip"}
+	redirectAcNameKeys = []string{"wlanacname", "basname", "acname", "nasname"}
+)
+
+type CarrierPortal struct {
+	*Client
+	profile *CarrierProfile
+
+	BaseUrl  string
+	AcName   string
+	LoggedIn bool
+}
+
+func NewCarrierPortal(c *Client, carrier string) *CarrierPortal {
+	return &CarrierPortal{Client: c, profile: carrierProfiles[carrier]}
+}
+
+func (p *CarrierPortal) Auth(URL string) error {
+	parsed, err := url.Parse(URL)
+	if err != nil {
+		return err
+	}
+	if parsed.Host == "" {
+		return errors.New("missing portal host")
+	}
+
+	query := parsed.Query()
+	p.BaseUrl = parsed.Scheme + "://" + parsed.Host
+	p.UserIP = firstQueryValue(query, redirectUserIPKeys)
+	p.AcIP = firstQueryValue(query, redirectAcIPKeys)
+	p.AcName = firstQueryValue(query, redirectAcNameKeys)
+
+	if p.UserIP == "" {
+		return errors.New("missing user ip")
+	}
+
+	password, err := p.portalPassword(URL)
+	if err != nil {
+		return err
+	}
+
+	form := p.identityForm()
+	form.Set(p.profile.UserParam, p.username())
+	form.Set(p.profile.PasswordParam, password)
+	for k, v := range p.profile.Extra {
+		form.Set(k, v)
+	}
+
+	data, err := p.PostForm(p.profile.LoginPath, form)
+	if err != nil {
+		return err
+	}
+
+	if !p.isSuccess(data) {
+		return &PortalError{Message: strings.TrimSpace(string(data))}
+	}
+
+	p.LoggedIn = true
+	return nil
+}
+
+// Heartbeat 移动/联通门户没有保活接口，会话失效只能靠定时的网络检测发现，发现后重新认证
+func (p *CarrierPortal) Heartbeat() error {
+	return nil
+}
+
+func (p *CarrierPortal) Logout() error {
+	if !p.LoggedIn {
+		return nil
+	}
+	p.LoggedIn = false
+
+	form := p.identityForm()
+	form.Set(p.profile.UserParam, p.username())
+
+	_, err := p.PostForm(p.profile.LogoutPath, form)
+	return err
+}
+
+func (p *CarrierPortal) identityForm() url.Values {
+	form := url.Values{}
+	form.Set(p.profile.UserIPParam, p.UserIP)
+	if p.AcIP != "" {
+		form.Set(p.profile.AcIPParam, p.AcIP)
+	}
+	if p.AcName != "" {
+		form.Set(p.profile.AcNameParam, p.AcName)
+	}
+	return form
+}
+
+func (p *CarrierPortal) isSuccess(data []byte) bool {
+	body := strings.ReplaceAll(string(data), " ", "")
+	for _, mark := range p.profile.SuccessMarks {
+		if strings.Contains(body, mark) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CarrierPortal) PostForm(path string, form url.Values) ([]byte, error) {
+	request, err := http.NewRequestWithContext(p.requestContext(), http.MethodPost, p.BaseUrl+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := p.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+
+	return io.ReadAll(response.Body)
+}
+
+func firstQueryValue(query url.Values, keys []string) string {
+	for _, key := range keys {
+		if v := query.Get(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
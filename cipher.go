@@ -8,6 +8,7 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
 
 	"github.com/emmansun/gmsm/sm4"
 	"github.com/emmansun/gmsm/zuc"
@@ -18,6 +19,8 @@ type Cipher interface {
 	Decrypt(data []byte) ([]byte, error)
 }
 
+const DefaultAlgoID = "00000000-0000-0000-0000-000000000000"
+
 const (
 	AlgoAesCbc    = "CAFBCBAD-B6E7-4CAB-8A67-14D39F00CE1E"
 	AlgoAesEcb    = "A474B1C2-3DE0-4EA2-8C5F-7093409CE6C4"
@@ -55,6 +58,25 @@ func NewCipher(algoID string) Cipher {
 	return nil
 }
 
+// ErrDecryptResponse 表示门户的响应无法用当前的算法解密，通常是门户不接受协商的AlgoID
+var ErrDecryptResponse = errors.New("decrypt response")
+
+// decryptResponse 解密门户的响应。响应来自可能被冒充的网关，解密实现中的越界等panic也转换为错误返回
+func decryptResponse(c Cipher, data []byte) (plain []byte, err error) {
+	if c == nil {
+		return nil, errors.New("cipher not initialized")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			plain, err = nil, fmt.Errorf("%w: %v", ErrDecryptResponse, r)
+		}
+	}()
+	if plain, err = c.Decrypt(data); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptResponse, err)
+	}
+	return plain, nil
+}
+
 func encodeHexUpper(data []byte) []byte {
 	dst := make([]byte, hex.EncodedLen(len(data)))
 	hex.Encode(dst, data)
@@ -2,15 +2,18 @@ package main
 
 import (
 	"context"
-	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"math"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,8 +25,39 @@ type Client struct {
 	HttpClient      *http.Client
 	Ctx             context.Context
 	Cancel          context.CancelFunc
-	cipher          Cipher
+	reqCtx          context.Context
+	portal          Portal
 	heartBeatTicker *time.Ticker
+	emulation       *EmulationProfile
+	heartbeatFails  int
+	spans           []*Span
+	authTrace       *Span
+	checkLog        LogDeduper
+	traffic         *trafficBase
+	idle            idleState
+	fatal           error
+	ssidErr         error
+	ssidPolled      bool
+	account         *AccountProfile
+	probeURL        string
+	probeBody       []byte
+	breaker         *circuitBreaker
+	logFile         *os.File
+	commands        chan string
+	notifiers       []Notifier
+	events          chan *Event
+	// abandoned 表示客户端已被看门狗替换，退出时不再下线
+	abandoned atomic.Bool
+
+	mu            sync.Mutex
+	status        ClientStatus
+	session       *Session
+	pendingImport *sessionImport
+	authLatency   *Histogram
+	heartbeatRTT  *Histogram
+
+	subMu       sync.Mutex
+	subscribers map[chan *Event]struct{}
 
 	UserIP     string
 	AcIP       string
@@ -49,10 +83,176 @@ func NewClient(config *Config) (*Client, error) {
 		return nil, errors.New("username or password is empty")
 	}
 
+	switch config.Carrier {
+	case "", CarrierTelecom:
+	case CarrierCMCC, CarrierUnicom:
+		if config.Portal == "" {
+			config.Portal = config.Carrier
+		}
+	default:
+		return nil, errors.New("unknown carrier: " + config.Carrier)
+	}
+	if config.Portal == "" {
+		config.Portal = PortalESurfing
+	}
+	if _, ok := portalRegistry[config.Portal]; !ok {
+		return nil, errors.New("unknown portal: " + config.Portal)
+	}
+	switch config.ProtocolMode {
+	case "", ProtocolClient:
+	case ProtocolWeb:
+		if config.Portal != PortalESurfing {
+			return nil, errors.New("protocol_mode web is only supported by the esurfing portal")
+		}
+	default:
+		return nil, errors.New("unknown protocol mode: " + config.ProtocolMode)
+	}
+	switch config.SrunVersion {
+	case "", SrunVersion3000, SrunVersion4000:
+	default:
+		return nil, errors.New("unknown srun version: " + config.SrunVersion)
+	}
+
+	switch config.DetectMode {
+	case "":
+		config.DetectMode = DetectModeHTTP
+	case DetectModeHTTP, DetectModeDNS, DetectModeTCP:
+	default:
+		return nil, errors.New("unknown detect mode: " + config.DetectMode)
+	}
+	emulation, err := resolveEmulation(config)
+	if err != nil {
+		return nil, err
+	}
+	if config.UDPHeartbeat != nil {
+		if err := config.UDPHeartbeat.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if config.Macvlan != nil {
+		if err := config.Macvlan.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if config.CircuitBreaker != nil {
+		if err := config.CircuitBreaker.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateProfiles(config); err != nil {
+		return nil, err
+	}
+	if err := validateAlgoIDs(config.AlgoIDs); err != nil {
+		return nil, err
+	}
+	if !validPasswordEncoding(config.PasswordEncoding) {
+		return nil, errors.New("unknown password encoding: " + config.PasswordEncoding)
+	}
+	switch config.TicketMethod {
+	case "", TicketMethodPost, TicketMethodGet:
+	default:
+		return nil, errors.New("unknown ticket method: " + config.TicketMethod)
+	}
+	if config.DnsProbeDomain == "" {
+		config.DnsProbeDomain = DefaultDnsProbeDomain
+	}
+	if len(config.TCPProbeAddresses) == 0 {
+		config.TCPProbeAddresses = defaultTCPProbeAddresses
+	}
+	for _, address := range config.TCPProbeAddresses {
+		if host, _, err := net.SplitHostPort(address); err != nil || net.ParseIP(host) == nil {
+			return nil, errors.New("tcp probe address must be ip:port: " + address)
+		}
+	}
+	if config.TCPProbeURL == "" {
+		host, _, _ := net.SplitHostPort(config.TCPProbeAddresses[0])
+		config.TCPProbeURL = "http://" + host + "/"
+	}
+	if len(config.DetectProbes) == 0 {
+		config.DetectProbes = []*ProbeConfig{{URL: DetectURL}}
+	}
+	for _, probe := range config.DetectProbes {
+		if err := probe.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := dnsServers(config); err != nil {
+		return nil, err
+	}
+	if err := validateHosts(config.Hosts); err != nil {
+		return nil, err
+	}
+	if err := validateRelay(config); err != nil {
+		return nil, err
+	}
+	if config.ClientID != "" {
+		if _, err := uuid.Parse(config.ClientID); err != nil {
+			return nil, errors.New("invalid client_id: " + config.ClientID)
+		}
+	}
+
+	var notifiers []Notifier
+	for _, nc := range config.Notifiers {
+		n, err := NewNotifier(nc)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+
+	if config.ConnectTimeout <= 0 {
+		config.ConnectTimeout = 5000
+	}
+	if config.RequestTimeout <= 0 {
+		config.RequestTimeout = 10000
+	}
+
+	if config.RequestRetries == 0 {
+		config.RequestRetries = 2
+	}
+	if config.KeepAlive == 0 {
+		config.KeepAlive = 30000
+	}
+	if config.MaxIdleConns <= 0 {
+		config.MaxIdleConns = 4
+	}
+	if config.IdleConnTimeout <= 0 {
+		config.IdleConnTimeout = 90000
+	}
+	if config.TLSHandshakeTimeout <= 0 {
+		config.TLSHandshakeTimeout = 10000
+	}
+
+	if config.BindInterface != "" {
+		name, err := ResolveInterface(config.BindInterface)
+		if err != nil {
+			return nil, err
+		}
+		config.BindInterface = name
+	}
+
 	transport, err := NewHttpTransport(config)
 	if err != nil {
 		return nil, errors.New(fmt.Errorf("failed to create transport: %w", err).Error())
 	}
+	if replayer != nil {
+		transport = replayer
+	} else if recorder != nil {
+		transport = recorder.Transport(transport)
+	}
+
+	logFile, err := OpenLogFile(config)
+	if err != nil {
+		return nil, err
+	}
+	logOutput := console
+	if logFile != nil {
+		logOutput = NewRedactWriter(logFile)
+	}
+	RegisterSecret(config.Password)
+	for _, profile := range config.Profiles {
+		RegisterSecret(profile.Password)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -60,13 +260,34 @@ func NewClient(config *Config) (*Client, error) {
 
 	// 保存用于日志显示的接口名称
 	bindInterfaceDisplay := config.BindInterface
+	if config.BindIP != "" {
+		bindInterfaceDisplay = config.BindIP
+	}
 	if bindInterfaceDisplay == "" {
 		bindInterfaceDisplay = "sys_default"
 	}
+	logPrefix := LogPrefix(config, rid, bindInterfaceDisplay)
 
 	if config.CheckInterval <= 0 {
 		config.CheckInterval = 10000
 	}
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = 60000
+	}
+	config.HeartbeatInterval = max(config.HeartbeatInterval, int(heartbeatMinInterval/time.Millisecond))
+	config.HeartbeatInterval = min(config.HeartbeatInterval, int(heartbeatMaxInterval/time.Millisecond))
+	if config.HeartbeatFailureThreshold == 0 {
+		config.HeartbeatFailureThreshold = 3
+	}
+	if config.IdleThreshold <= 0 {
+		config.IdleThreshold = 65536
+	}
+	if config.SSIDPollInterval <= 0 {
+		config.SSIDPollInterval = 5000
+	}
+	if config.MaintenanceInterval <= 0 {
+		config.MaintenanceInterval = 1800000
+	}
 	if config.RetryInterval == 0 {
 		config.RetryInterval = 10000
 	}
@@ -84,121 +305,446 @@ func NewClient(config *Config) (*Client, error) {
 			},
 			Transport: transport,
 		},
-		AlgoID: "00000000-0000-0000-0000-000000000000",
+		AlgoID:    DefaultAlgoID,
+		logFile:   logFile,
+		emulation: emulation,
 		Log: log.New(
-			os.Stdout,
-			"["+rid+"][user:"+config.Username+" bind_device:"+bindInterfaceDisplay+"] ",
+			io.MultiWriter(logOutput, logHub.Writer(config.Username, logPrefix)),
+			logPrefix,
 			log.LstdFlags|log.Lmsgprefix,
 		),
-		heartBeatTicker: time.NewTicker(time.Duration(math.MaxInt32)),
+		heartBeatTicker: time.NewTicker(heartbeatIdle),
+		commands:        make(chan string, 4),
+		notifiers:       notifiers,
+		events:          make(chan *Event, 16),
+		authLatency:     NewHistogram(latencyBuckets),
+		heartbeatRTT:    NewHistogram(latencyBuckets),
+		status: ClientStatus{
+			Username:  config.Username,
+			Interface: bindInterfaceDisplay,
+			Portal:    config.Portal,
+		},
+	}
+
+	cl.portal = NewPortal(config.Portal, cl)
+	if config.CircuitBreaker != nil {
+		cl.breaker = &circuitBreaker{cfg: config.CircuitBreaker}
+	}
+
+	if config.TLSInsecureSkipVerify {
+		cl.Log.Println(T("WARNING: TLS certificate verification is DISABLED for portal requests, anyone on the path can impersonate the portal"))
 	}
 
 	return cl, nil
 }
 
-func (c *Client) Start() {
-	c.Log.Println("client start")
-	defer wg.Done()
+// Run 运行客户端主循环直到 ctx 或客户端自身被取消（返回 nil），
+// 或者遇到重试也无法恢复的错误（如账号密码错误），此时返回该错误
+func (c *Client) Run(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, c.Cancel)
+	defer stop()
+
+	c.Log.Println(T("client start"))
+	defer c.closeLog()
+	defer c.Cancel()
+	go c.runNotifiers()
+	if c.Config.UDPHeartbeat != nil {
+		go c.runUDPHeartbeat()
+	}
+	if c.hasHooks() {
+		events, unsubscribe := c.Subscribe(16)
+		defer unsubscribe()
+		go c.runHooks(events)
+	}
 	defer c.heartBeatTicker.Stop()
-	defer c.Logout()
+	defer c.shutdownLogout()
 
-	if err := c.CheckNetwork(); err != nil {
-		c.Log.Printf("Network check failed:%v", err)
+	// 配置了 ssids 时先确认连接的是校园网，pollSSID 在校园网上会立即检测
+	var ssidTicks <-chan time.Time
+	if len(c.Config.SSIDs) > 0 {
+		ssidTicker := time.NewTicker(time.Millisecond * time.Duration(c.Config.SSIDPollInterval))
+		defer ssidTicker.Stop()
+		ssidTicks = ssidTicker.C
+		c.pollSSID()
+	} else {
+		c.RunCheck()
 	}
+	c.markLoop()
 
 	ticker := time.NewTicker(time.Millisecond * time.Duration(c.Config.CheckInterval))
 	defer ticker.Stop()
 
 	for {
+		if c.fatal != nil {
+			c.Log.Printf(T("client stopped: %v"), c.fatal)
+			return c.fatal
+		}
+
 		select {
 		case <-c.Ctx.Done():
-			c.Log.Println("client context cancel")
-			return
+			c.Log.Println(T("client context cancel"))
+			return nil
 		case <-ticker.C:
-			if err := c.CheckNetwork(); err != nil {
-				c.Log.Printf("Network check failed:%v", err)
+			c.markLoop()
+			if c.Status().Paused || !c.onCampus() || c.inMaintenance() || !c.breakerAllow() {
+				continue
+			}
+			if c.Status().Idle {
+				if !c.idleDemand() {
+					continue
+				}
+				c.Log.Println(T("traffic resumed, re-authenticating"))
+				c.setIdle(false, "")
 			}
+			c.RunCheck()
+			c.checkIdle()
+		case <-ssidTicks:
+			c.markLoop()
+			c.pollSSID()
+		case command := <-c.commands:
+			c.HandleCommand(command)
 		case <-c.heartBeatTicker.C:
-			err := c.SendHeartbeat()
+			c.heartbeatTicked()
+			start := time.Now()
+			err := c.traceHeartbeat(c.portal.Heartbeat)
+			c.observeHeartbeatRTT(time.Since(start))
+			c.recordHeartbeat(err)
+			open := c.recordPortalCall(err)
 			if err != nil {
-				c.Log.Printf("send heartbeat error: %v", err)
+				c.Log.Printf(T("send heartbeat error: %v"), err)
+				c.emitError(EventHeartbeatFailed, err)
+				if !open {
+					c.heartbeatFailed()
+				}
 			} else {
-				c.Log.Println("send heartbeat")
+				c.heartbeatFails = 0
+				c.Log.Println(T("send heartbeat"))
+				c.Emit(&Event{Type: EventHeartbeatSent})
 			}
 		}
 	}
 }
 
-func (c *Client) SendHeartbeat() error {
-	if c.KeepUrl == "" {
-		return errors.New("keep url is empty, auth may have failed")
+// Send 把控制命令交给客户端自己的 goroutine 执行，队列满时丢弃
+func (c *Client) Send(command string) bool {
+	select {
+	case c.commands <- command:
+		return true
+	default:
+		return false
 	}
+}
 
-	stateXML, err := c.GenerateStateXML()
-	if err != nil {
-		return errors.New(err.Error())
+func (c *Client) HandleCommand(command string) {
+	switch command {
+	case CommandRelogin:
+		c.Log.Println(T("relogin requested"))
+		c.setPaused(false)
+		c.setIdle(false, "")
+		c.clearMaintenance()
+		c.resetBreaker()
+		c.Logout()
+		c.setOnline(false)
+		c.RunCheck()
+	case CommandLogout:
+		c.Log.Println(T("logout requested, network check paused until relogin"))
+		c.setPaused(true)
+		c.stopHeartbeat()
+		c.Logout()
+		c.setOnline(false)
+	case CommandImport:
+		c.handleImport()
+	case CommandCheck:
+		// 空闲下线的账号不因为续租而重新认证，等有流量时再认证
+		s := c.Status()
+		if s.Paused || s.Idle || !c.onCampus() || c.inMaintenance() || !c.breakerAllow() {
+			return
+		}
+		c.Log.Println(T("network change reported, checking now"))
+		c.RunCheck()
 	}
+}
 
-	decrypted, err := c.PostXML(c.KeepUrl, stateXML)
-
-	var stateResp StateResponse
-	if err := xml.Unmarshal(decrypted, &stateResp); err != nil {
-		return errors.New(err.Error())
+// heartbeatFailed 累计连续的保活失败，达到阈值时认为会话已失效，清除状态并重新检测认证
+func (c *Client) heartbeatFailed() {
+	c.heartbeatFails++
+	if c.Config.HeartbeatFailureThreshold < 0 || c.heartbeatFails < c.Config.HeartbeatFailureThreshold {
+		return
 	}
 
-	interval, err := strconv.Atoi(stateResp.Interval)
-	if err != nil {
-		return errors.New(err.Error())
+	c.Log.Printf(T("%d consecutive heartbeats failed, re-authenticating"), c.heartbeatFails)
+	c.stopHeartbeat()
+	c.goOffline("heartbeat failed")
+	c.Logout()
+	c.RunCheck()
+}
+
+// heartbeatIdle 是未认证时保活定时器的间隔，相当于停用
+const heartbeatIdle = time.Duration(math.MaxInt64)
+
+func (c *Client) resetHeartbeat(interval time.Duration) {
+	c.heartBeatTicker.Reset(interval)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.HeartbeatInterval = interval
+	c.status.NextHeartbeat = time.Now().Add(interval)
+}
+
+func (c *Client) stopHeartbeat() {
+	c.heartBeatTicker.Reset(heartbeatIdle)
+	c.heartbeatFails = 0
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.HeartbeatInterval = 0
+	c.status.NextHeartbeat = time.Time{}
+}
+
+// 门户返回的保活间隔被限制在这个范围内，过短会频繁请求门户，过长会话会在下次保活前过期
+const (
+	heartbeatMinInterval = 10 * time.Second
+	heartbeatMaxInterval = 15 * time.Minute
+)
+
+// ScheduleHeartbeat 按门户返回的秒数设置下一次保活，无效时使用配置的默认间隔，超出范围时截断。
+// 无论返回的间隔是否有效，定时器都会重新设置，会话不会因为一次异常的响应而停止保活
+func (c *Client) ScheduleHeartbeat(interval string) error {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(interval), 10, 64)
+	if err != nil || seconds <= 0 {
+		c.resetHeartbeat(time.Millisecond * time.Duration(c.Config.HeartbeatInterval))
+		return fmt.Errorf(T("invalid heartbeat interval %q, fallback to %dms"), interval, c.Config.HeartbeatInterval)
 	}
 
-	c.heartBeatTicker.Reset(time.Duration(interval) * time.Second)
-	return nil
+	switch {
+	case seconds < int64(heartbeatMinInterval/time.Second):
+		c.resetHeartbeat(heartbeatMinInterval)
+	case seconds > int64(heartbeatMaxInterval/time.Second):
+		c.resetHeartbeat(heartbeatMaxInterval)
+	default:
+		c.resetHeartbeat(time.Duration(seconds) * time.Second)
+		return nil
+	}
+	return fmt.Errorf(T("heartbeat interval %ds out of range, clamped to %v"), seconds, c.Status().HeartbeatInterval)
 }
 
 func (c *Client) Logout() {
-	request, _ := c.NewGetRequest("http://connect.rom.miui.com/generate_204")
-	resp, _ := c.HttpClient.Do(request)
-	if resp != nil && resp.StatusCode == http.StatusNoContent && c.cipher != nil {
-		stateXML, _ := c.GenerateStateXML()
-		_, _ = c.PostXMLWithTimeout(c.TermUrl, stateXML)
-		c.Log.Println("log out request sent")
+	online := c.Status().Online
+	if err := c.portal.Logout(); err != nil {
+		c.Log.Printf(T("logout error: %v"), err)
+		return
+	}
+	c.endTrafficSession()
+	if online {
+		c.Emit(&Event{Type: EventLoggedOut})
 	}
 }
 
-func (c *Client) CheckNetwork() error {
-	request, err := c.NewGetRequest("http://connect.rom.miui.com/generate_204")
-	if err != nil {
-		return errors.New(err.Error())
+// logoutTimeout 是退出时下线请求的总时长上限
+const logoutTimeout = 3 * time.Second
+
+// shutdownLogout 退出时下线。此时 c.Ctx 已经取消，下线请求改用不随之取消的短超时 context，
+// 保证退出不会卡在无响应的门户上
+func (c *Client) shutdownLogout() {
+	if c.abandoned.Load() {
+		return
 	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Ctx), logoutTimeout)
+	defer cancel()
+
+	c.reqCtx = ctx
+	defer func() {
+		c.reqCtx = nil
+	}()
+	c.Logout()
+}
+
+// RunCheck 执行一轮检测，并刷新状态文件
+func (c *Client) RunCheck() {
+	c.updateTraffic()
+	if err := c.CheckNetwork(); err != nil {
+		if c.Ctx.Err() != nil {
+			return
+		}
+		c.checkLog.Print(c.Log, fmt.Sprintf(T("Network check failed:%v"), err))
+	} else {
+		c.checkLog.Flush(c.Log)
+	}
+
+	if err := WriteStatusFile(); err != nil {
+		c.Log.Printf(T("write status file error: %v"), err)
+	}
+}
 
-	resp, err := c.HttpClient.Do(request)
+func (c *Client) CheckNetwork() (err error) {
+	root := c.startSpan("check_network")
+	defer func() {
+		c.endSpan(root, err)
+	}()
+
+	// 上一轮被拦截的响应已经过时，DNS/TCP检测和门户发现不会重新设置，不能留给这一轮的认证
+	c.probeURL, c.probeBody = "", nil
+
+	if c.Config.DetectMode == DetectModeDNS {
+		err = c.CheckNetworkDNS()
+	} else if c.Config.DetectMode == DetectModeTCP {
+		err = c.CheckNetworkTCP()
+	} else {
+		for _, probe := range c.Config.DetectProbes {
+			if err = c.Probe(probe); err == nil {
+				break
+			}
+		}
+	}
+
+	if err != nil && c.Ctx.Err() == nil && c.Config.PortalDiscovery {
+		if portalURL := c.DiscoverPortal(); portalURL != "" {
+			c.goOffline("auth required")
+			c.stopHeartbeat()
+			c.Log.Printf(T("no redirect from detection, discovered portal %s"), redirectTarget(portalURL))
+			err = c.HandleRedirect(portalURL)
+		}
+	}
+
+	if err != nil && c.Ctx.Err() == nil {
+		err = c.ClassifyFailure(err)
+		c.goOffline(RedactError(err))
+		c.setError(err)
+	}
+	return err
+}
+
+// Probe 请求探测地址，满足在线条件时标记在线，需要认证时从重定向中取出门户地址并认证
+func (c *Client) Probe(probe *ProbeConfig) error {
+	span := c.startSpan("detect")
+	span.SetAttr("url", probe.URL)
+	resp, body, err := c.fetchProbe(probe.URL)
+	c.endSpan(span, err)
 	if err != nil {
-		return errors.New(err.Error())
+		return err
 	}
-	defer func(Body io.ReadCloser) {
-		_ = Body.Close()
-	}(resp.Body)
+	// 保留被拦截的响应，WISPr等门户的登录参数就在其中
+	c.probeURL, c.probeBody = probe.URL, body
 
-	switch resp.StatusCode {
-	case http.StatusNoContent:
+	if probe.Matches(resp, body) {
+		c.setOnline(true)
 		return nil
+	}
 
+	switch resp.StatusCode {
 	case http.StatusFound:
-		c.heartBeatTicker.Reset(time.Duration(math.MaxInt32))
-		c.Log.Println("auth required")
-		return c.HandleRedirect(resp)
+		c.goOffline("auth required")
+		c.stopHeartbeat()
+		c.Log.Println(T("auth required"))
+		return c.HandleRedirect(resp.Header.Get("Location"))
+
+	case http.StatusOK:
+		portalURL := ExtractPortalURL(resp.Request.URL, body)
+		if portalURL == "" {
+			if err = DetectMaintenance(body); err != nil {
+				c.enterMaintenance(err)
+				return err
+			}
+			return errors.New("unexpected status code: 200 without portal redirect")
+		}
+
+		c.goOffline("auth required")
+		c.stopHeartbeat()
+		c.Log.Println(T("auth required (page redirect)"))
+		return c.HandleRedirect(portalURL)
 
 	default:
 		return errors.New(fmt.Sprintf("unexpected status code: %d", resp.StatusCode))
 	}
 }
 
-func (c *Client) HandleRedirect(resp *http.Response) error {
-	if err := c.Auth(resp.Header.Get("Location")); err != nil {
-		c.Log.Printf("auth failed: %v", err)
+// fetchProbe 请求探测地址并读出响应内容
+func (c *Client) fetchProbe(URL string) (*http.Response, []byte, error) {
+	request, err := c.NewGetRequest(URL)
+	if err != nil {
+		return nil, nil, errors.New(err.Error())
+	}
+
+	resp, err := c.Do(request)
+	if err != nil {
+		return nil, nil, errors.New(err.Error())
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, nil, errors.New(err.Error())
+	}
+	return resp, body, nil
+}
+
+// goOffline 标记离线，之前在线时发出离线通知
+func (c *Client) goOffline(reason string) {
+	if c.Status().Online {
+		c.Notify(EventOffline, reason)
+	}
+	c.setOnline(false)
+}
+
+func (c *Client) HandleRedirect(portalURL string) error {
+	// 熔断期间没有发出认证，不计入认证耗时
+	if !c.breakerAllow() {
+		return nil
+	}
+	start := time.Now()
+	defer func() {
+		c.observeAuthLatency(time.Since(start))
+	}()
+	c.selectProfile(portalURL)
+	portalURL = c.RelayURL(portalURL)
+	c.notePortalBase(portalURL)
+	span := c.startSpan("auth")
+	span.SetAttr("portal", c.Config.Portal)
+	err := c.portal.Auth(portalURL)
+	if kicker, ok := c.portal.(SessionKicker); ok {
+		kick := false
+		if errors.Is(err, ErrDeviceLimit) && c.Config.KickOnDeviceLimit {
+			c.Log.Printf(T("auth rejected by device limit, terminating other sessions: %v"), err)
+			kick = true
+		} else if errors.Is(err, ErrAlreadyOnline) && c.Config.KickOnAlreadyOnline {
+			c.Log.Printf(T("account already online, terminating stale session: %v"), err)
+			kick = true
+		}
+
+		if kick {
+			if kickErr := c.Traced("kick_sessions", kicker.KickSessions); kickErr != nil {
+				c.Log.Printf(T("terminate sessions failed: %v"), kickErr)
+			} else {
+				err = c.portal.Auth(portalURL)
+			}
+		}
+	}
+
+	c.endSpan(span, err)
+
+	if errors.Is(err, ErrMaintenance) {
+		c.recordAuthFailure(err)
+		c.enterMaintenance(err)
+		return nil
+	}
+	if err != nil {
+		c.recordAuthFailure(err)
+		c.Log.Printf(T("auth failed: %v"), err)
+		c.emitError(EventAuthFailed, err)
+		c.recordPortalCall(err)
+		if errors.Is(err, ErrBadCredentials) {
+			c.fatal = err
+		}
 		return nil
 	}
+	c.recordPortalCall(nil)
 
-	c.Log.Println("auth finished")
+	c.setAuthenticated()
+	c.startTrafficSession()
+	c.markAuthTrace()
+	c.Log.Println(T("auth finished"))
+	c.Notify(EventOnline, "authenticated, ip "+c.UserIP)
 	return nil
 }
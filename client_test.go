@@ -0,0 +1,37 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// newTestClient 创建一个不绑定接口、日志只输出到控制台的客户端，测试结束时取消。
+// 配置文件路径指向临时目录，ClientID等状态不会写到源码目录
+func newTestClient(t *testing.T, config *Config) *Client {
+	t.Helper()
+	configFilePath = filepath.Join(t.TempDir(), "config.json")
+	if config.Username == "" {
+		config.Username = "test-user"
+	}
+	if config.Password == "" {
+		config.Password = "test-password"
+	}
+	c, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(c.discard)
+	return c
+}
+
+func TestNewClientSrunVersion(t *testing.T) {
+	for _, version := range []string{"", SrunVersion3000, SrunVersion4000} {
+		newTestClient(t, &Config{Portal: PortalSrun, SrunVersion: version})
+	}
+
+	configFilePath = filepath.Join(t.TempDir(), "config.json")
+	if c, err := NewClient(&Config{Username: "test-user", Password: "test-password", Portal: PortalSrun, SrunVersion: "4.0"}); err == nil {
+		c.discard()
+		t.Fatal("NewClient accepted srun_version 4.0")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/google/uuid"
+)
+
+// StableClientID 返回该账号固定的ClientID。门户把每个新的ClientID当作一台新设备计入设备数，
+// 因此只在第一次运行时生成并保存，之后一直复用；配置了 client_id 时使用配置的值
+func (c *Client) StableClientID() uuid.UUID {
+	if c.Config.ClientID != "" {
+		if id, err := uuid.Parse(c.Config.ClientID); err == nil {
+			return id
+		}
+	}
+
+	if id, err := uuid.Parse(c.loadState().ClientID); err == nil {
+		return id
+	}
+
+	id := uuid.New()
+	if err := c.updateState(func(s *AccountState) { s.ClientID = id.String() }); err != nil {
+		c.Log.Printf(T("save client id error: %v"), err)
+	}
+	return id
+}
+
+// Fingerprint 是上报给门户的完整设备标识，保存在 fingerprint_file 中，
+// 复制到其他主机后门户看到的仍是同一台设备
+type Fingerprint struct {
+	ClientID   string `json:"client_id"`
+	MacAddress string `json:"mac_address"`
+	Hostname   string `json:"hostname"`
+	UserAgent  string `json:"user_agent"`
+}
+
+// LoadFingerprint 读取该账号保存的设备标识，没有时沿用当前的ClientID，按模拟配置生成其余的值并写入文件
+func (c *Client) LoadFingerprint() *Fingerprint {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	path := c.Config.FingerprintFile
+	fingerprints := map[string]*Fingerprint{}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &fingerprints)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.Log.Printf(T("read %s error: %v"), path, err)
+	}
+
+	if fp := fingerprints[c.username()]; fp != nil {
+		if _, err := uuid.Parse(fp.ClientID); err == nil && fp.MacAddress != "" && fp.Hostname != "" {
+			return fp
+		}
+	}
+
+	fp := &Fingerprint{
+		ClientID:   c.ClientID.String(),
+		MacAddress: GenerateRandomMAC(),
+		Hostname:   c.emulation.Hostname(),
+		UserAgent:  c.emulation.UserAgent,
+	}
+	fingerprints[c.username()] = fp
+	if data, err = json.MarshalIndent(fingerprints, "", "  "); err == nil {
+		err = os.WriteFile(path, append(data, '\n'), 0600)
+	}
+	if err != nil {
+		c.Log.Printf(T("save fingerprint error: %v"), err)
+	}
+	return fp
+}
+
+// applyIdentity 设置本次认证上报的设备标识。配置了 fingerprint_file 时使用其中保存的值，
+// 否则 ClientID 固定、MAC 和主机名每次随机；client_id、user_agent、relay_mac 配置优先
+func (c *Client) applyIdentity() {
+	c.ClientID = c.StableClientID()
+	c.Hostname = c.emulation.Hostname()
+	c.MacAddress = GenerateRandomMAC()
+
+	if c.Config.FingerprintFile != "" {
+		fp := c.LoadFingerprint()
+		if id, err := uuid.Parse(fp.ClientID); err == nil && c.Config.ClientID == "" {
+			c.ClientID = id
+		}
+		c.Hostname = fp.Hostname
+		c.MacAddress = fp.MacAddress
+		if fp.UserAgent != "" && c.Config.UserAgent == "" {
+			c.emulation.UserAgent = fp.UserAgent
+		}
+	}
+
+	if c.Config.RelayMAC != "" {
+		c.MacAddress = c.Config.RelayMAC
+	}
+	RegisterSecret(c.ClientID.String())
+}
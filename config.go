@@ -7,12 +7,105 @@ import (
 )
 
 type Config struct {
-	Username      string `json:"username"`
-	Password      string `json:"password"`
-	CheckInterval int    `json:"check_interval"`
-	RetryInterval int    `json:"retry_interval"`
-	BindInterface string `json:"bind_interface"`
-	DnsAddress    string `json:"dns_address"`
+	Username          string `json:"username"`
+	Password          string `json:"password"`
+	CheckInterval     int    `json:"check_interval"`
+	RetryInterval     int    `json:"retry_interval"`
+	HeartbeatInterval int    `json:"heartbeat_interval"`
+	ConnectTimeout    int    `json:"connect_timeout"`
+	RequestTimeout    int    `json:"request_timeout"`
+	RequestRetries    int    `json:"request_retries"`
+	BindInterface     string `json:"bind_interface"`
+	BindIP            string `json:"bind_ip"`
+	BindToDevice      bool   `json:"bind_to_device"`
+	VRF               string `json:"vrf"`
+	DnsAddress        string `json:"dns_address"`
+	Portal            string `json:"portal"`
+	Carrier           string `json:"carrier"`
+	SrunAcID          string `json:"srun_ac_id"`
+	SrunVersion       string `json:"srun_version"`
+
+	ProtocolMode  string `json:"protocol_mode"`
+	WebLoginPath  string `json:"web_login_path"`
+	WebKeepPath   string `json:"web_keep_path"`
+	WebLogoutPath string `json:"web_logout_path"`
+
+	WISPrAllowHTTP bool `json:"wispr_allow_http"`
+
+	DnsServers []string          `json:"dns_servers"`
+	Hosts      map[string]string `json:"hosts"`
+
+	CAFile                string `json:"ca_file"`
+	TLSInsecureSkipVerify bool   `json:"tls_insecure_skip_verify"`
+	TLSServerName         string `json:"tls_server_name"`
+
+	KeepAlive           int `json:"keep_alive"`
+	MaxIdleConns        int `json:"max_idle_conns"`
+	IdleConnTimeout     int `json:"idle_conn_timeout"`
+	TLSHandshakeTimeout int `json:"tls_handshake_timeout"`
+
+	XMLFieldAliases map[string][]string `json:"xml_field_aliases"`
+	TicketMethod    string              `json:"ticket_method"`
+	AlgoIDs         []string            `json:"algo_ids"`
+
+	PasswordEncoding string `json:"password_encoding"`
+
+	Emulation string `json:"emulation"`
+	UserAgent string `json:"user_agent"`
+	OSTag     string `json:"ostag"`
+
+	FingerprintFile string `json:"fingerprint_file"`
+
+	UDPHeartbeat *UDPHeartbeatConfig `json:"udp_heartbeat"`
+	KeepTraffic  bool                `json:"keep_traffic"`
+
+	CircuitBreaker *CircuitBreakerConfig `json:"circuit_breaker"`
+
+	IdleTimeout   int `json:"idle_timeout"`
+	IdleThreshold int `json:"idle_threshold"`
+
+	SSIDs            []string `json:"ssids"`
+	SSIDPollInterval int      `json:"ssid_poll_interval"`
+
+	Profiles []*AccountProfile `json:"profiles"`
+
+	HeartbeatFailureThreshold int `json:"heartbeat_failure_threshold"`
+	MaintenanceInterval       int `json:"maintenance_interval"`
+
+	KickOnDeviceLimit   bool   `json:"kick_on_device_limit"`
+	KickOnAlreadyOnline bool   `json:"kick_on_already_online"`
+	ClientID            string `json:"client_id"`
+
+	RelayIP  string `json:"relay_ip"`
+	RelayMAC string `json:"relay_mac"`
+
+	RedirectParams map[string]string `json:"redirect_params"`
+
+	Macvlan *MacvlanConfig `json:"macvlan"`
+
+	DetectMode     string         `json:"detect_mode"`
+	DnsProbeDomain string         `json:"dns_probe_domain"`
+	DnsProbeExpect []string       `json:"dns_probe_expect"`
+	DnsHijackIP    []string       `json:"dns_hijack_ip"`
+	DetectProbes   []*ProbeConfig `json:"detect_probes"`
+
+	PortalDiscovery  bool     `json:"portal_discovery"`
+	PortalCandidates []string `json:"portal_candidates"`
+
+	TCPProbeAddresses []string `json:"tcp_probe_addresses"`
+	TCPProbeURL       string   `json:"tcp_probe_url"`
+
+	Notifiers []*NotifierConfig `json:"notifiers"`
+
+	LogFile string `json:"log_file"`
+
+	Name      string            `json:"name"`
+	LogTag    string            `json:"log_tag"`
+	LogFields map[string]string `json:"log_fields"`
+
+	OnOnline   string `json:"on_online"`
+	OnOffline  string `json:"on_offline"`
+	OnAuthFail string `json:"on_auth_fail"`
 }
 
 var Configs []*Config
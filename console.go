@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+const (
+	levelInfo = iota
+	levelWarn
+	levelError
+)
+
+// 按日志内容判断级别的关键字，同时包含中英文
+var (
+	errorKeywords = [][]byte{[]byte("error"), []byte("failed"), []byte("失败"), []byte("错误")}
+	warnKeywords  = [][]byte{[]byte("WARNING"), []byte("retry"), []byte("rejected"), []byte("hijacked"),
+		[]byte("queue full"), []byte("警告"), []byte("重试"), []byte("拒绝"), []byte("劫持")}
+)
+
+var quietMode bool
+
+// console 是标准输出的日志目标，终端上按级别着色，-quiet 时只输出警告和错误
+var console io.Writer = os.Stdout
+
+// ConsoleWriter 逐行处理 log.Logger 的输出
+type ConsoleWriter struct {
+	mu    sync.Mutex
+	out   io.Writer
+	color bool
+	quiet bool
+}
+
+func NewConsoleWriter(file *os.File, quiet bool) *ConsoleWriter {
+	return &ConsoleWriter{out: file, color: isTerminal(file), quiet: quiet}
+}
+
+func (w *ConsoleWriter) Write(p []byte) (int, error) {
+	level := logLevel(p)
+	if w.quiet && level == levelInfo {
+		return len(p), nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.color || level == levelInfo {
+		return w.out.Write(p)
+	}
+
+	color := "\033[33m"
+	if level == levelError {
+		color = "\033[31m"
+	}
+	line := bytes.TrimRight(p, "\n")
+	if _, err := w.out.Write([]byte(color + string(line) + "\033[0m\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func logLevel(line []byte) int {
+	for _, k := range errorKeywords {
+		if bytes.Contains(line, k) {
+			return levelError
+		}
+	}
+	for _, k := range warnKeywords {
+		if bytes.Contains(line, k) {
+			return levelWarn
+		}
+	}
+	return levelInfo
+}
+
+// isTerminal 判断输出是否为终端，设置了 NO_COLOR 或在Windows上时不着色
+func isTerminal(file *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || runtime.GOOS == "windows" {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	CommandStatus  = "status"
+	CommandRelogin = "relogin"
+	CommandLogout  = "logout"
+	CommandReload  = "reload"
+	CommandSession = "session"
+	// CommandSessionUnsafe 导出包含完整ticket和ClientID的会话，只接受来自控制socket的请求
+	CommandSessionUnsafe = "session-unsafe"
+	CommandImport        = "import"
+	CommandCheck         = "check"
+)
+
+// ControlServer 在 unix socket 上接收本地工具发来的命令，访问控制依靠 socket 文件的权限
+type ControlServer struct {
+	Path     string
+	listener net.Listener
+}
+
+func StartControlServer(path string) (*ControlServer, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+
+	listener, err := listenControl(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen control socket: %w", err)
+	}
+
+	s := &ControlServer{Path: path, listener: listener}
+	go s.serve()
+	return s, nil
+}
+
+func (s *ControlServer) Close() {
+	_ = s.listener.Close()
+	_ = os.Remove(s.Path)
+}
+
+func (s *ControlServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle 每个连接处理一条命令：`<command> [username]`，import 命令的参数为一行会话JSON
+func (s *ControlServer) handle(conn net.Conn) {
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && line == "" {
+		return
+	}
+
+	command, target, _ := strings.Cut(strings.TrimSpace(line), " ")
+	if command == "" {
+		return
+	}
+
+	_, _ = conn.Write([]byte(ExecuteCommand(command, strings.TrimSpace(target))))
+}
+
+// ExecuteCommand 执行控制命令并返回给调用方的文本结果，target 为空时作用于所有账号
+func ExecuteCommand(command string, target string) string {
+	switch command {
+	case CommandStatus:
+		var b strings.Builder
+		for _, c := range SelectClients(target) {
+			b.WriteString(FormatStatus(c.Status()))
+			b.WriteByte('\n')
+		}
+		return b.String()
+
+	case CommandRelogin, CommandLogout:
+		selected := SelectClients(target)
+		if len(selected) == 0 {
+			return "error: no such client\n"
+		}
+		for _, c := range selected {
+			c.Send(command)
+		}
+		return "ok\n"
+
+	case CommandCheck:
+		for _, c := range checkTargets(target) {
+			c.Send(command)
+		}
+		return "ok\n"
+
+	case CommandSession:
+		return ExportSessions(target, false)
+
+	case CommandSessionUnsafe:
+		return ExportSessions(target, true)
+
+	case CommandImport:
+		return importSessionCommand(target)
+
+	case CommandReload:
+		if err := ReloadClients(); err != nil {
+			return "error: " + err.Error() + "\n"
+		}
+		return "ok\n"
+
+	default:
+		return "error: unknown command " + command + "\n"
+	}
+}
+
+// SendControlCommand 连接运行中进程的控制socket，发送一条命令并返回结果
+func SendControlCommand(path string, line string) (string, error) {
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+	_ = conn.SetDeadline(time.Now().Add(15 * time.Second))
+
+	if _, err = conn.Write([]byte(line + "\n")); err != nil {
+		return "", err
+	}
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return "", err
+	}
+	return string(reply), nil
+}
+
+func FormatStatus(s ClientStatus) string {
+	authTime, ticketAge := "-", "-"
+	if !s.AuthTime.IsZero() {
+		authTime = s.AuthTime.Format(time.DateTime)
+		ticketAge = time.Since(s.AuthTime).Round(time.Second).String()
+	}
+	nextHeartbeat := "-"
+	if !s.NextHeartbeat.IsZero() {
+		nextHeartbeat = time.Until(s.NextHeartbeat).Round(time.Second).String()
+	}
+
+	return fmt.Sprintf("user=%s interface=%s portal=%s online=%t paused=%t ip=%s auth_time=%q ticket_age=%s "+
+		"next_heartbeat=%s auth=%d auth_failed=%d heartbeat=%d heartbeat_failed=%d rx_bytes=%d tx_bytes=%d last_error=%q",
+		s.Username, s.Interface, s.Portal, s.Online, s.Paused, s.UserIP, authTime, ticketAge,
+		nextHeartbeat, s.AuthCount, s.AuthFailures, s.HeartbeatCount, s.HeartbeatFailures, s.SessionRxBytes, s.SessionTxBytes, s.LastError)
+}
@@ -0,0 +1,39 @@
+//go:build !windows
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// listenControl 先在只有当前用户能进入的临时目录中创建 socket 并设为 0600，再重命名到 path。
+// 其他用户在 chmod 之前无法通过临时目录连接，重命名后看到的就已经是 0600 的文件。
+// 不用 umask，它对整个进程生效，会影响其他 goroutine 同时创建的文件
+func listenControl(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".ctl-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	tmp := filepath.Join(dir, "s")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// 监听地址是临时路径，关闭时由 ControlServer.Close 删除 path
+	listener.SetUnlinkOnClose(false)
+
+	if err = os.Chmod(tmp, 0600); err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
@@ -0,0 +1,39 @@
+//go:build !windows
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestControlSocketPermissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "esurfing.sock")
+	server, err := StartControlServer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		t.Fatalf("control socket mode %v is accessible by other users", perm)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial control socket: %v", err)
+	}
+	_ = conn.Close()
+
+	// 创建 socket 用的临时目录不应留下
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("socket directory has %d entries, want only the socket", len(entries))
+	}
+}
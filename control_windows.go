@@ -0,0 +1,8 @@
+package main
+
+import "net"
+
+// listenControl Windows 上 socket 文件的访问权限由所在目录的ACL决定
+func listenControl(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
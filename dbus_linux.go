@@ -0,0 +1,504 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 这里只实现了监听 NetworkManager 信号所需的最小 D-Bus 客户端：EXTERNAL 认证、方法调用和消息解码
+
+const (
+	dbusMethodCall   = 1
+	dbusMethodReturn = 2
+	dbusError        = 3
+	dbusSignal       = 4
+
+	dbusFieldPath        = 1
+	dbusFieldInterface   = 2
+	dbusFieldMember      = 3
+	dbusFieldErrorName   = 4
+	dbusFieldReplySerial = 5
+	dbusFieldDestination = 6
+	dbusFieldSender      = 7
+	dbusFieldSignature   = 8
+
+	// dbusMaxMessage 是接受的单条消息上限，系统总线的消息远小于这个值
+	dbusMaxMessage = 1 << 20
+
+	defaultSystemBus = "/var/run/dbus/system_bus_socket"
+)
+
+type dbusMessage struct {
+	Type        byte
+	Serial      uint32
+	ReplySerial uint32
+	Path        string
+	Interface   string
+	Member      string
+	ErrorName   string
+	Sender      string
+	Body        []any
+}
+
+type dbusConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	serial uint32
+	// pending 是 Call 等待返回期间收到的其他消息(主要是信号)，由之后的 Read 按顺序返回
+	pending []*dbusMessage
+}
+
+// dbusMaxPending 是 Call 期间最多保留的消息数，超过时丢弃最早的
+const dbusMaxPending = 256
+
+// systemBusPath 返回系统总线的 unix socket 路径，DBUS_SYSTEM_BUS_ADDRESS 优先
+func systemBusPath() string {
+	for _, part := range strings.Split(os.Getenv("DBUS_SYSTEM_BUS_ADDRESS"), ";") {
+		if path, ok := strings.CutPrefix(part, "unix:path="); ok {
+			path, _, _ = strings.Cut(path, ",")
+			return path
+		}
+	}
+	return defaultSystemBus
+}
+
+func dialSystemBus() (*dbusConn, error) {
+	conn, err := net.DialTimeout("unix", systemBusPath(), 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	bus := &dbusConn{conn: conn, reader: bufio.NewReader(conn)}
+	if err = bus.auth(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if _, err = bus.Call("/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", "org.freedesktop.DBus"); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return bus, nil
+}
+
+// auth 使用 EXTERNAL 方式认证，总线按 socket 对端的uid识别身份
+func (b *dbusConn) auth() error {
+	_ = b.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	defer func() {
+		_ = b.conn.SetDeadline(time.Time{})
+	}()
+
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := b.conn.Write([]byte("\x00AUTH EXTERNAL " + uid + "\r\n")); err != nil {
+		return err
+	}
+	line, err := b.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK") {
+		return fmt.Errorf("dbus auth rejected: %s", strings.TrimSpace(line))
+	}
+	_, err = b.conn.Write([]byte("BEGIN\r\n"))
+	return err
+}
+
+func (b *dbusConn) Close() error {
+	return b.conn.Close()
+}
+
+// Call 调用方法并等待返回，参数只支持字符串。等待期间收到的其他消息留给之后的 Read
+func (b *dbusConn) Call(path, iface, member, destination string, args ...string) (*dbusMessage, error) {
+	b.serial++
+	serial := b.serial
+	if _, err := b.conn.Write(encodeDBusCall(serial, path, iface, member, destination, args)); err != nil {
+		return nil, err
+	}
+
+	_ = b.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer func() {
+		_ = b.conn.SetReadDeadline(time.Time{})
+	}()
+	for {
+		msg, err := b.readMessage()
+		if err != nil {
+			return nil, err
+		}
+		if msg.ReplySerial != serial || (msg.Type != dbusMethodReturn && msg.Type != dbusError) {
+			if len(b.pending) == dbusMaxPending {
+				b.pending = b.pending[1:]
+			}
+			b.pending = append(b.pending, msg)
+			continue
+		}
+		if msg.Type == dbusError {
+			detail := ""
+			if len(msg.Body) > 0 {
+				detail, _ = msg.Body[0].(string)
+			}
+			return nil, fmt.Errorf("%s %s: %s", member, msg.ErrorName, detail)
+		}
+		return msg, nil
+	}
+}
+
+// Read 返回下一条消息，Call 期间收到的消息优先
+func (b *dbusConn) Read() (*dbusMessage, error) {
+	if len(b.pending) > 0 {
+		msg := b.pending[0]
+		b.pending = b.pending[1:]
+		return msg, nil
+	}
+	return b.readMessage()
+}
+
+// readMessage 从连接读取并解码一条消息
+func (b *dbusConn) readMessage() (*dbusMessage, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(b.reader, fixed); err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("dbus: invalid endianness")
+	}
+	bodyLen := order.Uint32(fixed[4:])
+	fieldsLen := order.Uint32(fixed[12:])
+	headerLen := (16 + fieldsLen + 7) &^ 7
+	if uint64(headerLen)+uint64(bodyLen) > dbusMaxMessage {
+		return nil, errors.New("dbus: message too large")
+	}
+
+	data := make([]byte, headerLen+bodyLen)
+	copy(data, fixed)
+	if _, err := io.ReadFull(b.reader, data[16:]); err != nil {
+		return nil, err
+	}
+	return decodeDBusMessage(data, order, int(headerLen))
+}
+
+func decodeDBusMessage(data []byte, order binary.ByteOrder, headerLen int) (*dbusMessage, error) {
+	if len(data) < 16 || headerLen > len(data) {
+		return nil, errors.New("dbus: truncated message")
+	}
+	msg := &dbusMessage{Type: data[1], Serial: order.Uint32(data[8:])}
+	r := &dbusReader{data: data[:headerLen], pos: 12, order: order}
+	fields, _, err := r.value("a(yv)", 0)
+	if err != nil {
+		return nil, fmt.Errorf("dbus: malformed header: %w", err)
+	}
+	signature := ""
+	for _, field := range fields.([]any) {
+		pair := field.([]any)
+		value := pair[1]
+		switch pair[0].(byte) {
+		case dbusFieldPath:
+			msg.Path, _ = value.(string)
+		case dbusFieldInterface:
+			msg.Interface, _ = value.(string)
+		case dbusFieldMember:
+			msg.Member, _ = value.(string)
+		case dbusFieldErrorName:
+			msg.ErrorName, _ = value.(string)
+		case dbusFieldReplySerial:
+			msg.ReplySerial, _ = value.(uint32)
+		case dbusFieldSender:
+			msg.Sender, _ = value.(string)
+		case dbusFieldSignature:
+			signature, _ = value.(string)
+		}
+	}
+
+	// 正文的对齐从正文开头算起，正文开头本身按8对齐，因此直接在整条消息上计算即可
+	r = &dbusReader{data: data, pos: headerLen, order: order}
+	for signature != "" {
+		var value any
+		if value, signature, err = r.value(signature, 0); err != nil {
+			return nil, fmt.Errorf("dbus: malformed %s body: %w", msg.Member, err)
+		}
+		msg.Body = append(msg.Body, value)
+	}
+	return msg, nil
+}
+
+func encodeDBusCall(serial uint32, path, iface, member, destination string, args []string) []byte {
+	w := &dbusWriter{}
+	w.buf = append(w.buf, 'l', dbusMethodCall, 0, 1, 0, 0, 0, 0)
+	w.uint32(serial)
+	w.uint32(0)
+
+	start := len(w.buf)
+	field := func(code byte, signature string, value string) {
+		w.align(8)
+		w.buf = append(w.buf, code)
+		w.signature(signature)
+		if signature == "g" {
+			w.signature(value)
+		} else {
+			w.string(value)
+		}
+	}
+	w.align(8)
+	field(dbusFieldPath, "o", path)
+	field(dbusFieldInterface, "s", iface)
+	field(dbusFieldMember, "s", member)
+	field(dbusFieldDestination, "s", destination)
+	if len(args) > 0 {
+		field(dbusFieldSignature, "g", strings.Repeat("s", len(args)))
+	}
+	binary.LittleEndian.PutUint32(w.buf[12:], uint32(len(w.buf)-start))
+	w.align(8)
+
+	bodyStart := len(w.buf)
+	for _, arg := range args {
+		w.string(arg)
+	}
+	binary.LittleEndian.PutUint32(w.buf[4:], uint32(len(w.buf)-bodyStart))
+	return w.buf
+}
+
+type dbusWriter struct {
+	buf []byte
+}
+
+func (w *dbusWriter) align(n int) {
+	for len(w.buf)%n != 0 {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+func (w *dbusWriter) uint32(v uint32) {
+	w.align(4)
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, v)
+}
+
+func (w *dbusWriter) string(s string) {
+	w.uint32(uint32(len(s)))
+	w.buf = append(append(w.buf, s...), 0)
+}
+
+func (w *dbusWriter) signature(s string) {
+	w.buf = append(append(append(w.buf, byte(len(s))), s...), 0)
+}
+
+// dbusMaxDepth 是签名中数组、结构和variant的最大嵌套层数，D-Bus规范限制数组和结构各32层
+const dbusMaxDepth = 64
+
+var errDBusTruncated = errors.New("value exceeds message")
+
+// dbusReader 按签名解码值，消息来自总线上的任意进程，所有长度都要检查
+type dbusReader struct {
+	data  []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+func (r *dbusReader) align(n int) {
+	r.pos = (r.pos + n - 1) &^ (n - 1)
+}
+
+func (r *dbusReader) next(n int) ([]byte, error) {
+	if n < 0 || r.pos > len(r.data) || n > len(r.data)-r.pos {
+		return nil, errDBusTruncated
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *dbusReader) uint32() (uint32, error) {
+	r.align(4)
+	b, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return r.order.Uint32(b), nil
+}
+
+// text 读取 n 字节的字符串和结尾的NUL
+func (r *dbusReader) text(n int) (string, error) {
+	b, err := r.next(n + 1)
+	if err != nil {
+		return "", err
+	}
+	if b[n] != 0 {
+		return "", errors.New("string not terminated")
+	}
+	return string(b[:n]), nil
+}
+
+func (r *dbusReader) signature() (string, error) {
+	n, err := r.next(1)
+	if err != nil {
+		return "", err
+	}
+	return r.text(int(n[0]))
+}
+
+// value 解码签名中的第一个完整类型，返回解码的值和剩余的签名
+func (r *dbusReader) value(signature string, depth int) (any, string, error) {
+	if depth > dbusMaxDepth {
+		return nil, "", errors.New("nested too deep")
+	}
+	first, rest, err := splitDBusType(signature)
+	if err != nil {
+		return nil, "", err
+	}
+	switch first[0] {
+	case 'y':
+		b, err := r.next(1)
+		if err != nil {
+			return nil, "", err
+		}
+		return b[0], rest, nil
+	case 'b':
+		v, err := r.uint32()
+		return v != 0, rest, err
+	case 'n', 'q':
+		r.align(2)
+		b, err := r.next(2)
+		if err != nil {
+			return nil, "", err
+		}
+		return r.order.Uint16(b), rest, nil
+	case 'i', 'u', 'h':
+		v, err := r.uint32()
+		return v, rest, err
+	case 'x', 't', 'd':
+		r.align(8)
+		b, err := r.next(8)
+		if err != nil {
+			return nil, "", err
+		}
+		return r.order.Uint64(b), rest, nil
+	case 's', 'o':
+		n, err := r.uint32()
+		if err != nil {
+			return nil, "", err
+		}
+		s, err := r.text(int(min(n, dbusMaxMessage)))
+		return s, rest, err
+	case 'g':
+		s, err := r.signature()
+		return s, rest, err
+	case 'v':
+		inner, err := r.signature()
+		if err != nil {
+			return nil, "", err
+		}
+		value, left, err := r.value(inner, depth+1)
+		if err == nil && left != "" {
+			err = errors.New("variant signature " + inner + " is not a single type")
+		}
+		return value, rest, err
+	case '(':
+		r.align(8)
+		var fields []any
+		for inner := first[1 : len(first)-1]; inner != ""; {
+			var value any
+			if value, inner, err = r.value(inner, depth+1); err != nil {
+				return nil, "", err
+			}
+			fields = append(fields, value)
+		}
+		return fields, rest, nil
+	case 'a':
+		n, err := r.uint32()
+		if err != nil {
+			return nil, "", err
+		}
+		elem := first[1:]
+		if strings.ContainsRune("xtd({", rune(elem[0])) {
+			r.align(8)
+		}
+		if int64(n) > int64(len(r.data)-r.pos) {
+			return nil, "", errDBusTruncated
+		}
+		end := r.pos + int(n)
+		if elem[0] == '{' {
+			entries := map[string]any{}
+			for r.pos < end {
+				r.align(8)
+				key, inner, err := r.value(elem[1:len(elem)-1], depth+1)
+				if err != nil {
+					return nil, "", err
+				}
+				value, _, err := r.value(inner, depth+1)
+				if err != nil {
+					return nil, "", err
+				}
+				entries[fmt.Sprint(key)] = value
+			}
+			return entries, rest, nil
+		}
+		var items []any
+		for r.pos < end {
+			value, _, err := r.value(elem, depth+1)
+			if err != nil {
+				return nil, "", err
+			}
+			items = append(items, value)
+		}
+		return items, rest, nil
+	}
+	return nil, "", errors.New("unsupported dbus type " + first)
+}
+
+// splitDBusType 把签名拆成第一个完整类型和剩余部分
+func splitDBusType(signature string) (string, string, error) {
+	if signature == "" {
+		return "", "", errors.New("empty dbus signature")
+	}
+	switch signature[0] {
+	case 'a':
+		elem, rest, err := splitDBusType(signature[1:])
+		if err != nil {
+			return "", "", err
+		}
+		return "a" + elem, rest, nil
+	case '{':
+		first, rest, err := splitDBusContainer(signature, '{', '}')
+		if err == nil && (len(first) < 4 || strings.ContainsRune("a({v", rune(first[1]))) {
+			err = errors.New("invalid dict entry " + first)
+		}
+		return first, rest, err
+	case '(':
+		first, rest, err := splitDBusContainer(signature, '(', ')')
+		if err == nil && first == "()" {
+			err = errors.New("empty struct in dbus signature")
+		}
+		return first, rest, err
+	}
+	return signature[:1], signature[1:], nil
+}
+
+func splitDBusContainer(signature string, open, close byte) (string, string, error) {
+	depth := 0
+	for i := 0; i < len(signature); i++ {
+		switch signature[i] {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return signature[:i+1], signature[i+1:], nil
+			}
+		}
+	}
+	return "", "", errors.New("unbalanced dbus signature " + signature)
+}
@@ -0,0 +1,297 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// dbusMessages 是按 D-Bus 规范逐字节编码的消息，头部字段的顺序、对齐和内容与
+// dbus-daemon 和 NetworkManager 在系统总线上实际发出的消息一致
+var dbusMessages = map[string]string{
+	// NetworkManager.StateChanged(70 = NM_STATE_CONNECTED_GLOBAL)
+	"stateChanged": "6c040001040000006a0800007f00000001016f001f0000002f6f72672f667265656465736b746f702f4e6574776f726b4d616e6167657200020173001e0000006f72672e667265656465736b746f702e4e6574776f726b4d616e616765720000030173000c00000053746174654368616e6765640000000007017300040000003a312e3900000000080167000175000046000000",
+	// 同一条信号的大端编码
+	"stateChangedBigEndian": "42040001000000040000086a0000007f01016f000000001f2f6f72672f667265656465736b746f702f4e6574776f726b4d616e6167657200020173000000001e6f72672e667265656465736b746f702e4e6574776f726b4d616e616765720000030173000000000c53746174654368616e6765640000000007017300000000043a312e3900000000080167000175000000000046",
+	// Properties.PropertiesChanged("org.freedesktop.NetworkManager", {Connectivity: 4, ActiveConnections: [...], Metered: 4, NetworkingEnabled: true}, [])
+	"propertiesChanged": "6c040001d4000000700800008e00000001016f001f0000002f6f72672f667265656465736b746f702f4e6574776f726b4d616e6167657200020173001f0000006f72672e667265656465736b746f702e444275732e50726f7065727469657300030173001100000050726f706572746965734368616e6765640000000000000007017300040000003a312e3900000000080167000873617b73767d61730000001e0000006f72672e667265656465736b746f702e4e6574776f726b4d616e616765720000a80000000c000000436f6e6e6563746976697479000175000400000011000000416374697665436f6e6e656374696f6e730002616f00000037000000320000002f6f72672f667265656465736b746f702f4e6574776f726b4d616e616765722f416374697665436f6e6e656374696f6e2f330000070000004d65746572656400017500000400000000000000110000004e6574776f726b696e67456e61626c6564000162000000000100000000000000",
+	// Hello 的返回，reply serial 1
+	"helloReply": "6c0200010a000000010000003f00000006017300050000003a312e3432000000050175000100000007017300140000006f72672e667265656465736b746f702e44427573000000000801670001730000050000003a312e343200",
+	// AddMatch 的错误返回，reply serial 2
+	"addMatchError": "6c0300013a000000050000007700000006017300050000003a312e3432000000040173002b0000006f72672e667265656465736b746f702e444275732e4572726f722e4d6174636852756c65496e76616c69640000000000050175000200000007017300140000006f72672e667265656465736b746f702e44427573000000000801670001730000350000004d617463682072756c65206861732061206b65792077697468206e6f2073756273657175656e7420273d272063686172616374657200",
+	// AddMatch 的返回，没有正文，reply serial 2
+	"addMatchReply": "6c02000100000000060000003500000006017300050000003a312e3432000000050175000200000007017300140000006f72672e667265656465736b746f702e4442757300000000",
+}
+
+func dbusMessageBytes(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(dbusMessages[name])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func readDBusBytes(data []byte) (*dbusMessage, error) {
+	b := &dbusConn{reader: bufio.NewReader(bytes.NewReader(data))}
+	return b.Read()
+}
+
+func TestDecodeDBusMessages(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   dbusMessage
+		reason string
+	}{
+		{"stateChanged", dbusMessage{Type: dbusSignal, Serial: 2154, Path: nmPath, Interface: nmInterface,
+			Member: "StateChanged", Sender: ":1.9", Body: []any{uint32(70)}}, "state connected"},
+		{"stateChangedBigEndian", dbusMessage{Type: dbusSignal, Serial: 2154, Path: nmPath, Interface: nmInterface,
+			Member: "StateChanged", Sender: ":1.9", Body: []any{uint32(70)}}, "state connected"},
+		{"propertiesChanged", dbusMessage{Type: dbusSignal, Serial: 2160, Path: nmPath, Interface: "org.freedesktop.DBus.Properties",
+			Member: "PropertiesChanged", Sender: ":1.9", Body: []any{nmInterface, map[string]any{
+				"Connectivity":      uint32(4),
+				"ActiveConnections": []any{"/org/freedesktop/NetworkManager/ActiveConnection/3"},
+				"Metered":           uint32(4),
+				"NetworkingEnabled": true,
+			}, []any(nil)}}, "connectivity changed"},
+		{"helloReply", dbusMessage{Type: dbusMethodReturn, Serial: 1, ReplySerial: 1, Sender: "org.freedesktop.DBus",
+			Body: []any{":1.42"}}, ""},
+		{"addMatchError", dbusMessage{Type: dbusError, Serial: 5, ReplySerial: 2, Sender: "org.freedesktop.DBus",
+			ErrorName: "org.freedesktop.DBus.Error.MatchRuleInvalid",
+			Body:      []any{"Match rule has a key with no subsequent '=' character"}}, ""},
+		{"addMatchReply", dbusMessage{Type: dbusMethodReturn, Serial: 6, ReplySerial: 2, Sender: "org.freedesktop.DBus"}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg, err := readDBusBytes(dbusMessageBytes(t, test.name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*msg, test.want) {
+				t.Errorf("decoded %+v\nwant    %+v", *msg, test.want)
+			}
+			if reason := nmSignalReason(msg); reason != test.reason {
+				t.Errorf("nmSignalReason() = %q, want %q", reason, test.reason)
+			}
+		})
+	}
+}
+
+// TestDecodeDBusCorruptMessages 破坏消息中的每个字节，解码只能返回错误，不能panic
+func TestDecodeDBusCorruptMessages(t *testing.T) {
+	for name := range dbusMessages {
+		data := dbusMessageBytes(t, name)
+		for i := range data {
+			for _, b := range []byte{0x00, 0x7f, 0xff} {
+				corrupt := bytes.Clone(data)
+				corrupt[i] = b
+				_, _ = readDBusBytes(corrupt)
+			}
+		}
+		for n := range data {
+			if _, err := readDBusBytes(data[:n]); err == nil {
+				t.Errorf("%s truncated to %d bytes decoded without error", name, n)
+			}
+		}
+	}
+}
+
+func TestDecodeDBusRejectsBadBodies(t *testing.T) {
+	data := dbusMessageBytes(t, "helloReply")
+	// 把正文字符串的长度改成超出消息
+	bodyStart := len(data) - 10
+	binary.LittleEndian.PutUint32(data[bodyStart:], 1000)
+	if _, err := readDBusBytes(data); err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Errorf("oversized string: err = %v", err)
+	}
+
+	data = dbusMessageBytes(t, "helloReply")
+	data[len(data)-1] = 'x'
+	if _, err := readDBusBytes(data); err == nil {
+		t.Error("string without NUL terminator decoded")
+	}
+}
+
+func TestSplitDBusType(t *testing.T) {
+	tests := []struct {
+		signature, first, rest string
+		wantErr                bool
+	}{
+		{signature: "u", first: "u"},
+		{signature: "sa{sv}as", first: "s", rest: "a{sv}as"},
+		{signature: "a{sv}as", first: "a{sv}", rest: "as"},
+		{signature: "a(yv)", first: "a(yv)"},
+		{signature: "(s(ii))u", first: "(s(ii))", rest: "u"},
+		{signature: "aau", first: "aau"},
+		{signature: "", wantErr: true},
+		{signature: "a", wantErr: true},
+		{signature: "(su", wantErr: true},
+		{signature: "()", wantErr: true},
+		{signature: "{vs}", wantErr: true},
+		{signature: "{s}", wantErr: true},
+	}
+	for _, test := range tests {
+		first, rest, err := splitDBusType(test.signature)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("splitDBusType(%q) = %q, %q, want an error", test.signature, first, rest)
+			}
+			continue
+		}
+		if err != nil || first != test.first || rest != test.rest {
+			t.Errorf("splitDBusType(%q) = %q, %q, %v, want %q, %q", test.signature, first, rest, err, test.first, test.rest)
+		}
+	}
+}
+
+func TestDBusValueRejectsDeepNesting(t *testing.T) {
+	// 每一层都是签名为 "v" 的variant，不受签名长度限制，只能靠深度上限
+	data := bytes.Repeat([]byte{1, 'v', 0}, 200)
+	r := &dbusReader{data: data, order: binary.LittleEndian}
+	if _, _, err := r.value("v", 0); err == nil {
+		t.Error("decoded variants nested 200 levels deep")
+	}
+}
+
+func TestEncodeDBusCall(t *testing.T) {
+	rule := "type='signal',sender='" + nmInterface + "'"
+	msg, err := readDBusBytes(encodeDBusCall(7, "/org/freedesktop/DBus", "org.freedesktop.DBus", "AddMatch", "org.freedesktop.DBus", []string{rule}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := dbusMessage{Type: dbusMethodCall, Serial: 7, Path: "/org/freedesktop/DBus", Interface: "org.freedesktop.DBus",
+		Member: "AddMatch", Body: []any{rule}}
+	if !reflect.DeepEqual(*msg, want) {
+		t.Errorf("decoded %+v\nwant    %+v", *msg, want)
+	}
+}
+
+// fakeBus 在 unix socket 上模拟系统总线：完成认证，依次返回 Hello 和 AddMatch，
+// 第一个连接在 AddMatch 返回之前先发出一条 StateChanged 信号
+type fakeBus struct {
+	listener    net.Listener
+	accepted    chan net.Conn
+	connections atomic.Int32
+}
+
+func startFakeBus(t *testing.T) *fakeBus {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bus")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", "unix:path="+path+",guid=0123")
+	bus := &fakeBus{listener: listener, accepted: make(chan net.Conn, 4)}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go bus.serve(conn)
+		}
+	}()
+	return bus
+}
+
+func (f *fakeBus) serve(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	if line, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, "\x00AUTH EXTERNAL ") {
+		_ = conn.Close()
+		return
+	}
+	_, _ = conn.Write([]byte("OK 0123456789abcdef\r\n"))
+	if line, err := reader.ReadString('\n'); err != nil || line != "BEGIN\r\n" {
+		_ = conn.Close()
+		return
+	}
+
+	first := f.connections.Add(1) == 1
+	b := &dbusConn{conn: conn, reader: reader}
+	for _, reply := range []string{"helloReply", "addMatchReply"} {
+		if _, err := b.readMessage(); err != nil {
+			_ = conn.Close()
+			return
+		}
+		data, _ := hex.DecodeString(dbusMessages[reply])
+		if reply == "addMatchReply" && first {
+			signal, _ := hex.DecodeString(dbusMessages["stateChanged"])
+			data = append(signal, data...)
+		}
+		_, _ = conn.Write(data)
+	}
+	f.accepted <- conn
+}
+
+func TestDBusCallKeepsSignals(t *testing.T) {
+	startFakeBus(t)
+	bus, err := connectNM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+
+	msg, err := bus.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Member != "StateChanged" || nmSignalReason(msg) != "state connected" {
+		t.Errorf("first message after AddMatch = %+v, want the signal received during the call", msg)
+	}
+}
+
+func TestNMWatcherReconnects(t *testing.T) {
+	nmRetryMin = 10 * time.Millisecond
+	t.Cleanup(func() { nmRetryMin = 5 * time.Second })
+	fake := startFakeBus(t)
+
+	w, err := StartNMWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	first := <-fake.accepted
+	waitReason := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			w.mu.Lock()
+			reason := w.reason
+			w.mu.Unlock()
+			if reason == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("watcher reason = %q, want %q", reason, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitReason("state connected")
+
+	// 总线重启：旧连接断开后应当重新连接并订阅
+	_ = first.Close()
+	select {
+	case second := <-fake.accepted:
+		defer second.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("watcher did not reconnect")
+	}
+	waitReason("reconnected to D-Bus")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DetectURL = "http://connect.rom.miui.com/generate_204"
+
+	DetectModeHTTP = "http"
+	DetectModeDNS  = "dns"
+	DetectModeTCP  = "tcp"
+
+	DefaultDnsProbeDomain = "connect.rom.miui.com"
+)
+
+// ProbeConfig 描述一个探测地址以及怎样的响应算作在线
+type ProbeConfig struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+	Body   string `json:"body"`
+	Header string `json:"header"`
+}
+
+func (p *ProbeConfig) validate() error {
+	parsed, err := url.Parse(p.URL)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return errors.New("invalid detect probe url: " + p.URL)
+	}
+	if p.Status == 0 {
+		p.Status = http.StatusNoContent
+	}
+	return nil
+}
+
+// Matches 判断响应是否满足在线条件：状态码一致，并且包含指定的内容和响应头。
+// header 写作 "Name: value"，只写名称时只要求存在该响应头
+func (p *ProbeConfig) Matches(resp *http.Response, body []byte) bool {
+	if resp.StatusCode != p.Status {
+		return false
+	}
+	if p.Body != "" && !strings.Contains(string(body), p.Body) {
+		return false
+	}
+	if p.Header != "" {
+		name, value, _ := strings.Cut(p.Header, ":")
+		values := resp.Header.Values(strings.TrimSpace(name))
+		if len(values) == 0 || !strings.Contains(strings.Join(values, ", "), strings.TrimSpace(value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// 未认证时网关常把域名劫持到这些保留地址上
+var hijackPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("0.0.0.0/8"),
+}
+
+// CheckNetworkDNS 通过解析结果是否被劫持来判断是否需要认证，适用于拦截了204探测请求的网络
+func (c *Client) CheckNetworkDNS() error {
+	hijacked, err := c.DetectDNSHijack()
+	if err != nil {
+		return err
+	}
+	if hijacked == "" {
+		return nil
+	}
+
+	c.Log.Printf(T("dns answer hijacked to %s"), hijacked)
+	return c.Probe(&ProbeConfig{URL: "http://" + c.Config.DnsProbeDomain + "/", Status: http.StatusNoContent})
+}
+
+// 未认证时网关通常会重置或丢弃到外网 443 端口的连接，而 80 端口可能被网关代答
+var defaultTCPProbeAddresses = []string{"223.5.5.5:443", "1.12.12.12:443"}
+
+// CheckNetworkTCP 不经过DNS，直接向固定IP发起TCP连接判断是否在线；都连不上时
+// 按IP发起HTTP请求，让网关重定向到门户
+func (c *Client) CheckNetworkTCP() error {
+	control, _ := bindControl(c.Config)
+	dialer := &net.Dialer{
+		Timeout: time.Millisecond * time.Duration(c.Config.ConnectTimeout),
+		Control: control,
+	}
+	if ip, err := BindLocalIP(c.Config); err == nil && ip != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	for _, address := range c.Config.TCPProbeAddresses {
+		conn, err := dialer.DialContext(c.Ctx, "tcp", address)
+		if err == nil {
+			_ = conn.Close()
+			c.setOnline(true)
+			return nil
+		}
+	}
+
+	return c.Probe(&ProbeConfig{URL: c.Config.TCPProbeURL, Status: http.StatusNoContent})
+}
+
+// DetectDNSHijack 返回被劫持到的地址，未被劫持时返回空字符串
+func (c *Client) DetectDNSHijack() (string, error) {
+	ctx, cancel := context.WithTimeout(c.Ctx, 5*time.Second)
+	defer cancel()
+
+	addresses, err := GetResolver(c.Config).LookupNetIP(ctx, "ip4", c.Config.DnsProbeDomain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return "", errors.New("dns probe domain not found: " + c.Config.DnsProbeDomain)
+		}
+		return "", err
+	}
+
+	for _, addr := range addresses {
+		addr = addr.Unmap()
+		if matchAddress(addr, c.Config.DnsHijackIP) {
+			return addr.String(), nil
+		}
+		if len(c.Config.DnsProbeExpect) > 0 {
+			if !matchAddress(addr, c.Config.DnsProbeExpect) {
+				return addr.String(), nil
+			}
+			continue
+		}
+		for _, prefix := range hijackPrefixes {
+			if prefix.Contains(addr) {
+				return addr.String(), nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// matchAddress 判断地址是否命中列表，列表项可以是IP或CIDR
+func matchAddress(addr netip.Addr, list []string) bool {
+	for _, item := range list {
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err == nil && prefix.Contains(addr) {
+				return true
+			}
+			continue
+		}
+		if ip, err := netip.ParseAddr(item); err == nil && ip.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
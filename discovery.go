@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// 在网关上尝试的常见门户地址
+var discoveryTemplates = []string{"http://%s/", "http://%s:8080/", "http://%s:801/eportal/", "https://%s/"}
+
+// portalCandidates 返回自动发现门户时依次尝试的地址：配置的 portal_candidates，以及默认网关上的常见端口
+func (c *Client) portalCandidates() []string {
+	candidates := append([]string(nil), c.Config.PortalCandidates...)
+
+	iFace := c.Config.BindInterface
+	if c.Config.BindIP != "" {
+		iFace, _ = interfaceByIP(net.ParseIP(c.Config.BindIP))
+	}
+	if gateway, err := GetDefaultGateway(iFace); err == nil {
+		for _, template := range discoveryTemplates {
+			candidates = append(candidates, fmt.Sprintf(template, gateway))
+		}
+	}
+	return candidates
+}
+
+// DiscoverPortal 在探测没有得到重定向时(有的网关直接丢弃未认证的流量)，依次请求候选地址，
+// 返回第一个重定向或页面跳转到的门户地址
+func (c *Client) DiscoverPortal() string {
+	for _, candidate := range c.portalCandidates() {
+		resp, body, err := c.fetchProbe(candidate)
+		if err != nil {
+			continue
+		}
+
+		switch resp.StatusCode {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect:
+			if location, err := resp.Location(); err == nil {
+				return location.String()
+			}
+		case http.StatusOK:
+			if portalURL := ExtractPortalURL(resp.Request.URL, body); portalURL != "" {
+				return portalURL
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DnsProtocolUDP = "udp"
+	DnsProtocolTCP = "tcp"
+	DnsProtocolTLS = "tls"
+)
+
+// DnsServer 描述一个用于解析门户域名的DNS服务器
+type DnsServer struct {
+	Protocol   string
+	Address    string
+	ServerName string
+}
+
+// ParseDnsServer 解析 udp://119.29.29.29:53、tls://223.5.5.5:853#dns.alidns.com 形式的地址，
+// 不带协议时使用udp，不带端口时使用协议的默认端口
+func ParseDnsServer(s string) (*DnsServer, error) {
+	server := &DnsServer{Protocol: DnsProtocolUDP}
+
+	if scheme, rest, ok := strings.Cut(s, "://"); ok {
+		server.Protocol = strings.ToLower(scheme)
+		s = rest
+	}
+	s, server.ServerName, _ = strings.Cut(s, "#")
+
+	port := "53"
+	switch server.Protocol {
+	case DnsProtocolUDP, DnsProtocolTCP:
+	case DnsProtocolTLS:
+		port = "853"
+	default:
+		return nil, errors.New("unknown dns protocol: " + server.Protocol)
+	}
+
+	host, p, err := net.SplitHostPort(s)
+	if err != nil {
+		host, p = strings.Trim(s, "[]"), port
+	}
+	if net.ParseIP(host) == nil {
+		return nil, fmt.Errorf("dns server must be an ip address: %s", s)
+	}
+	server.Address = net.JoinHostPort(host, p)
+
+	if server.Protocol == DnsProtocolTLS && server.ServerName == "" {
+		server.ServerName = host
+	}
+	return server, nil
+}
+
+// dnsServers 返回配置的DNS服务器，dns_address 兼容旧配置排在最前
+func dnsServers(c *Config) ([]*DnsServer, error) {
+	addresses := c.DnsServers
+	if c.DnsAddress != "" {
+		addresses = append([]string{c.DnsAddress}, addresses...)
+	}
+
+	servers := make([]*DnsServer, 0, len(addresses))
+	for _, address := range addresses {
+		server, err := ParseDnsServer(address)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+// staticHostAddress 在 hosts 中查找域名，找到时返回替换为IP后的地址
+func staticHostAddress(hosts map[string]string, address string) string {
+	if len(hosts) == 0 {
+		return address
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	for domain, ip := range hosts {
+		if strings.EqualFold(strings.TrimSuffix(host, "."), domain) {
+			return net.JoinHostPort(ip, port)
+		}
+	}
+	return address
+}
+
+func validateHosts(hosts map[string]string) error {
+	for domain, ip := range hosts {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid ip for host %s: %s", domain, ip)
+		}
+	}
+	return nil
+}
+
+// GetResolver 返回解析门户域名用的解析器。配置了DNS服务器时通过绑定的网卡向其查询，
+// 一直使用同一个服务器，读取响应失败(超时等)后才轮换到下一个。
+// UDP服务器按解析器要求的网络连接，响应被截断时解析器会改用TCP重新查询同一个服务器
+func GetResolver(c *Config) *net.Resolver {
+	servers, err := dnsServers(c)
+	if err != nil || len(servers) == 0 {
+		return net.DefaultResolver
+	}
+
+	control, _ := bindControl(c)
+	localIP, _ := BindLocalIP(c)
+	var next atomic.Uint32
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			index := next.Load()
+			server := servers[int(index)%len(servers)]
+			failed := func() { next.CompareAndSwap(index, index+1) }
+
+			d := net.Dialer{
+				Timeout: 5 * time.Second,
+				Control: control,
+			}
+
+			var conn net.Conn
+			var err error
+			switch server.Protocol {
+			case DnsProtocolUDP:
+				if localIP != nil {
+					if strings.HasPrefix(network, "tcp") {
+						d.LocalAddr = &net.TCPAddr{IP: localIP}
+					} else {
+						d.LocalAddr = &net.UDPAddr{IP: localIP}
+					}
+				}
+				conn, err = d.DialContext(ctx, network, server.Address)
+			case DnsProtocolTCP:
+				if localIP != nil {
+					d.LocalAddr = &net.TCPAddr{IP: localIP}
+				}
+				conn, err = d.DialContext(ctx, "tcp", server.Address)
+			default:
+				if localIP != nil {
+					d.LocalAddr = &net.TCPAddr{IP: localIP}
+				}
+				td := &tls.Dialer{NetDialer: &d, Config: &tls.Config{ServerName: server.ServerName}}
+				conn, err = td.DialContext(ctx, "tcp", server.Address)
+			}
+			if err != nil {
+				failed()
+				return nil, err
+			}
+			// 解析器按是否实现 net.PacketConn 决定收发方式，UDP连接需要保留这些方法
+			if udp, ok := conn.(*net.UDPConn); ok {
+				return &dnsPacketConn{UDPConn: udp, failed: failed}, nil
+			}
+			return &dnsConn{Conn: conn, failed: failed}, nil
+		},
+	}
+}
+
+// dnsConn 在读取响应失败时通知解析器轮换服务器
+type dnsConn struct {
+	net.Conn
+	failed func()
+}
+
+func (c *dnsConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil && n == 0 {
+		c.failed()
+	}
+	return n, err
+}
+
+type dnsPacketConn struct {
+	*net.UDPConn
+	failed func()
+}
+
+func (c *dnsPacketConn) Read(b []byte) (int, error) {
+	n, err := c.UDPConn.Read(b)
+	if err != nil && n == 0 {
+		c.failed()
+	}
+	return n, err
+}
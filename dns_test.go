@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+// dnsAnswer 按查询构造响应：A 记录返回 192.0.2.1，其他类型返回空应答，truncated 时只设置 TC 位
+func dnsAnswer(query []byte, truncated bool) []byte {
+	end := 12
+	for end < len(query) && query[end] != 0 {
+		end += int(query[end]) + 1
+	}
+	end += 5
+	qtype := binary.BigEndian.Uint16(query[end-4:])
+
+	flags := uint16(0x8180)
+	answers := uint16(0)
+	if truncated {
+		flags |= 0x0200
+	} else if qtype == 1 {
+		answers = 1
+	}
+	response := binary.BigEndian.AppendUint16(nil, binary.BigEndian.Uint16(query))
+	response = binary.BigEndian.AppendUint16(response, flags)
+	response = binary.BigEndian.AppendUint16(response, 1)
+	response = binary.BigEndian.AppendUint16(response, answers)
+	response = append(response, 0, 0, 0, 0)
+	response = append(response, query[12:end]...)
+	if answers == 1 {
+		response = append(response, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 192, 0, 2, 1)
+	}
+	return response
+}
+
+// startDNSServer 在同一端口上监听UDP和TCP，UDP响应都带截断标记，TCP返回完整的应答
+func startDNSServer(t *testing.T) (address string, tcpQueries *atomic.Int32) {
+	t.Helper()
+	var udp net.PacketConn
+	var tcp net.Listener
+	for range 10 {
+		var err error
+		if udp, err = net.ListenPacket("udp", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		if tcp, err = net.Listen("tcp", udp.LocalAddr().String()); err == nil {
+			break
+		}
+		_ = udp.Close()
+	}
+	if tcp == nil {
+		t.Skip("no port free for both udp and tcp")
+	}
+	t.Cleanup(func() {
+		_ = udp.Close()
+		_ = tcp.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = udp.WriteTo(dnsAnswer(buf[:n], true), addr)
+		}
+	}()
+	tcpQueries = &atomic.Int32{}
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			tcpQueries.Add(1)
+			go func() {
+				defer func() { _ = conn.Close() }()
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				answer := dnsAnswer(query, false)
+				_, _ = conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(answer))), answer...))
+			}()
+		}
+	}()
+	return udp.LocalAddr().String(), tcpQueries
+}
+
+func TestResolverFallsBackToTCPOnTruncation(t *testing.T) {
+	address, tcpQueries := startDNSServer(t)
+
+	resolver := GetResolver(&Config{DnsServers: []string{"udp://" + address}})
+	addrs, err := resolver.LookupHost(context.Background(), "portal.example.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(addrs, "192.0.2.1") {
+		t.Errorf("LookupHost() = %v, want 192.0.2.1", addrs)
+	}
+	if tcpQueries.Load() == 0 {
+		t.Error("truncated answer was not retried over TCP")
+	}
+}
+
+func TestResolverRotatesOnlyAfterFailure(t *testing.T) {
+	first, firstQueries := startDNSServer(t)
+	second, secondQueries := startDNSServer(t)
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := closed.Addr().String()
+	_ = closed.Close()
+
+	resolver := GetResolver(&Config{DnsServers: []string{"tcp://" + dead, "tcp://" + first, "tcp://" + second}})
+	for range 3 {
+		if _, err = resolver.LookupHost(context.Background(), "portal.example."); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 第一次查询连接失败后换到下一个服务器，之后一直使用它，每次查询A和AAAA各一个连接
+	if got := firstQueries.Load(); got != 6 {
+		t.Errorf("first working server got %d connections, want 6", got)
+	}
+	if got := secondQueries.Load(); got != 0 {
+		t.Errorf("second working server got %d connections, want 0", got)
+	}
+}
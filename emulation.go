@@ -0,0 +1,53 @@
+package main
+
+import "errors"
+
+const EmulationAndroid = "android"
+
+// EmulationProfile 是官方客户端在请求头和 XML 中上报的设备信息，有的门户会校验这些字段
+type EmulationProfile struct {
+	// UserAgent 同时用于请求头和 XML 中的 user-agent
+	UserAgent string
+	// OSTag 为 XML 中的 ostag，为空时与主机名相同
+	OSTag string
+	// Hostname 生成上报的主机名
+	Hostname func() string
+}
+
+// emulationProfiles 只收录有抓包依据的客户端。其他客户端(iOS、PC)的字段没有可靠的抓包数据，
+// 不提供猜测的预设，需要时用 user_agent/ostag 按自己的抓包结果覆盖
+var emulationProfiles = map[string]*EmulationProfile{
+	EmulationAndroid: {
+		UserAgent: UserAgentAndroid,
+		Hostname:  func() string { return GenerateRandomString(10) },
+	},
+}
+
+// resolveEmulation 按配置选择模拟的客户端，并应用 user_agent/ostag 的覆盖
+func resolveEmulation(c *Config) (*EmulationProfile, error) {
+	name := c.Emulation
+	if name == "" {
+		name = EmulationAndroid
+	}
+	base, ok := emulationProfiles[name]
+	if !ok {
+		return nil, errors.New("unknown emulation profile: " + c.Emulation)
+	}
+
+	profile := *base
+	if c.UserAgent != "" {
+		profile.UserAgent = c.UserAgent
+	}
+	if c.OSTag != "" {
+		profile.OSTag = c.OSTag
+	}
+	return &profile, nil
+}
+
+// ostag 返回 XML 中上报的 ostag
+func (c *Client) ostag() string {
+	if c.emulation.OSTag != "" {
+		return c.emulation.OSTag
+	}
+	return c.Hostname
+}
@@ -0,0 +1,617 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ESurfing struct {
+	*Client
+	cipher Cipher
+
+	staleSession *esurfingSession
+}
+
+// esurfingSession 保存一次登录成功后的会话信息，用于下线残留会话，同时保存在 stateFile 中
+type esurfingSession struct {
+	cipher     Cipher
+	ClientID   uuid.UUID `json:"client_id"`
+	Hostname   string    `json:"hostname"`
+	MacAddress string    `json:"mac_address"`
+	UserIP     string    `json:"user_ip"`
+	Ticket     string    `json:"ticket"`
+	AlgoID     string    `json:"algo_id"`
+	TermUrl    string    `json:"term_url"`
+}
+
+func NewESurfing(c *Client) *ESurfing {
+	return &ESurfing{Client: c}
+}
+
+func (e *ESurfing) Auth(URL string) error {
+	log := e.Log
+
+	if e.RedirectUrl != "" {
+		if previous, current := redirectTarget(e.RedirectUrl), redirectTarget(URL); previous != current {
+			log.Printf(T("portal changed from %s to %s, re-bootstrapping"), previous, current)
+			e.ResetSession()
+		}
+	}
+	e.RedirectUrl = URL
+
+	if e.KeepUrl != "" && e.cipher != nil {
+		e.staleSession = e.snapshot()
+	}
+	e.KeepUrl = ""
+	e.TermUrl = ""
+
+	err := e.Traced("redirect", e.GetSchoolInfo)
+	if err != nil {
+		return err
+	}
+
+	e.applyIdentity()
+
+	err = e.Traced("econfig", e.GetEConfig)
+	if err != nil {
+		return err
+	}
+
+	err = e.Traced("user_ip", e.GetUserAndAcIP)
+	if err != nil {
+		return err
+	}
+
+	err = e.negotiateTicket()
+	if err != nil {
+		return err
+	}
+
+	RegisterSecret(e.Ticket)
+	log.Println(T("ticket:"), e.Ticket)
+
+	if err = e.sleep(time.Millisecond * 333); err != nil {
+		return err
+	}
+
+	err = e.Traced("login", e.Login)
+	if errors.Is(err, ErrChallengeExpired) {
+		// ticket 中的挑战值有效期很短，网关繁忙时可能在登录前就已过期，重新获取一次再登录
+		log.Printf(T("challenge expired, fetching a new ticket: %v"), err)
+		if err = e.Traced("ticket", e.GetTicket); err != nil {
+			return err
+		}
+		RegisterSecret(e.Ticket)
+		err = e.Traced("login", e.Login)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.saveSession()
+	return nil
+}
+
+// ResetSession 清除上一次认证得到的门户信息，换到另一个AC后这些值都已失效
+func (e *ESurfing) ResetSession() {
+	e.stopHeartbeat()
+	e.cipher = nil
+
+	e.Domain = ""
+	e.Area = ""
+	e.SchoolID = ""
+	e.UserIP = ""
+	e.AcIP = ""
+	e.Ticket = ""
+	e.AlgoID = DefaultAlgoID
+
+	e.IndexUrl = ""
+	e.TicketUrl = ""
+	e.AuthUrl = ""
+	e.KeepUrl = ""
+	e.TermUrl = ""
+}
+
+// redirectTarget 返回重定向地址中标识门户/AC的部分
+func redirectTarget(URL string) string {
+	parsed, err := url.Parse(URL)
+	if err != nil {
+		return URL
+	}
+
+	target := parsed.Host
+	if acIP := firstQueryValue(parsed.Query(), redirectAcIPKeys); acIP != "" {
+		target += " ac:" + acIP
+	}
+	return target
+}
+
+// portalURL 把门户返回的地址补全为绝对地址：相对路径按首页(或重定向)地址解析；
+// 首页走 HTTPS 而返回的是同一主机默认端口的 http 地址时改用 https，迁移到HTTPS的网关常常没有改配置中的地址。
+// 显式写了其他端口(如 :8080)的地址原样保留，那个端口上通常只有HTTP服务
+func (e *ESurfing) portalURL(ref string) string {
+	if ref == "" {
+		return ""
+	}
+	base := e.IndexUrl
+	if base == "" {
+		base = e.RedirectUrl
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	resolved, err := baseURL.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	port := resolved.Port()
+	if baseURL.Scheme == "https" && resolved.Scheme == "http" && resolved.Hostname() == baseURL.Hostname() &&
+		(port == "" || port == "80") {
+		resolved.Scheme = "https"
+		resolved.Host = strings.TrimSuffix(resolved.Host, ":80")
+	}
+	return resolved.String()
+}
+
+// maxSchemeRedirects 是获取学校信息前最多跟随的 http→https 跳转次数
+const maxSchemeRedirects = 3
+
+func (e *ESurfing) GetUserAndAcIP() error {
+	URLParsed, err := url.Parse(e.TicketUrl)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	e.UserIP = URLParsed.Query().Get("wlanuserip")
+	e.AcIP = URLParsed.Query().Get("wlanacip")
+
+	if e.UserIP == "" || e.AcIP == "" {
+		return errors.New("missing user ip or ac ip")
+	}
+
+	return nil
+}
+
+func (e *ESurfing) GetEConfig() error {
+	if e.IndexUrl == "" {
+		return errors.New("missing index url")
+	}
+
+	request, err := e.NewGetRequest(e.IndexUrl)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	response, err := e.Do(request)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	if err = DetectMaintenance(data); err != nil {
+		return err
+	}
+
+	eConfigData, err := FormatEConfig(data)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	eConfig := &EConfig{}
+
+	err = e.decodePortalResponse(eConfigData, eConfig)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	e.TicketUrl = e.RelayURL(e.portalURL(eConfig.TicketURL))
+	e.AuthUrl = e.portalURL(eConfig.AuthURL)
+
+	return nil
+}
+
+func (e *ESurfing) GetSchoolInfo() error {
+	if e.RedirectUrl == "" {
+		return errors.New("missing redirect URL")
+	}
+
+	// 迁移到HTTPS的网关会先把 http 的重定向地址再跳转到 https，跟随这类不带学校信息的跳转
+	URL := e.RedirectUrl
+	var response *http.Response
+	for hops := 0; ; hops++ {
+		request, err := e.NewGetRequest(URL)
+		if err != nil {
+			return errors.New(err.Error())
+		}
+
+		response, err = e.Do(request)
+		if err != nil {
+			return errors.New(err.Error())
+		}
+		_ = response.Body.Close()
+
+		location, err := response.Location()
+		if err != nil || response.Header.Get("schoolid") != "" || hops >= maxSchemeRedirects ||
+			location.Scheme != "https" || request.URL.Scheme != "http" {
+			break
+		}
+		URL = location.String()
+	}
+
+	if response.Header.Get("domain") != "" && response.Header.Get("area") != "" &&
+		response.Header.Get("schoolid") != "" && response.Header.Get("Location") != "" {
+		e.Domain = response.Header.Get("domain")
+		e.Area = response.Header.Get("area")
+		e.SchoolID = response.Header.Get("schoolid")
+		location, err := response.Location()
+		if err != nil {
+			return errors.New(err.Error())
+		}
+		e.IndexUrl = location.String()
+	} else {
+		return errors.New("missing school info")
+	}
+
+	if response.StatusCode != 302 {
+		return errors.New("invalid process of authorization at stage 2")
+	}
+
+	return nil
+}
+
+func (e *ESurfing) GetAlgoId() error {
+	request, err := e.NewPostRequest(e.TicketUrl, []byte(e.AlgoID))
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	response, err := e.Do(request)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+
+	algoIdData, err := io.ReadAll(response.Body)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", response.StatusCode)
+	}
+
+	e.AlgoID, _, err = DecodeAlgoID(algoIdData)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrAlgoIDRejected, err)
+	}
+
+	return nil
+}
+
+// GetTicket 获取ticket。ticket_method 未指定时先用 POST XML，失败后改用部分旧网关要求的 GET 查询参数形式
+func (e *ESurfing) GetTicket() error {
+	switch e.Config.TicketMethod {
+	case TicketMethodGet:
+		return e.GetTicketByQuery()
+	case TicketMethodPost:
+		return e.PostTicket()
+	}
+
+	err := e.PostTicket()
+	if err == nil || e.Ctx.Err() != nil {
+		return err
+	}
+	e.Log.Printf(T("get ticket by POST failed, retry with GET: %v"), err)
+	return e.GetTicketByQuery()
+}
+
+func (e *ESurfing) PostTicket() error {
+	getTicketXML, err := e.GenerateGetTicketXML()
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	ticketData, err := e.PostXML(e.TicketUrl, getTicketXML)
+	if err != nil {
+		return err
+	}
+
+	ticketXML := &TicketResponse{}
+
+	err = e.decodePortalResponse(ticketData, ticketXML)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrAlgoIDRejected, err)
+	}
+	if ticketXML.Ticket == "" {
+		return ticketXML.rejection()
+	}
+
+	e.Ticket = ticketXML.Ticket
+	return nil
+}
+
+// GetTicketByQuery 以 GET 查询参数的形式请求ticket，响应可能是明文，也可能按 AlgoID 加密
+func (e *ESurfing) GetTicketByQuery() error {
+	ticketURL, err := url.Parse(e.TicketUrl)
+	if err != nil {
+		return err
+	}
+
+	query := ticketURL.Query()
+	query.Set("client-id", e.ClientID.String())
+	query.Set("local-time", time.Now().Format(time.DateTime))
+	query.Set("host-name", e.Hostname)
+	query.Set("ipv4", e.UserIP)
+	query.Set("mac", e.MacAddress)
+	query.Set("ostag", e.ostag())
+	query.Set("gwip", e.AcIP)
+	ticketURL.RawQuery = query.Encode()
+
+	request, err := e.NewGetRequest(ticketURL.String())
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Algo-ID", e.AlgoID)
+
+	response, err := e.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", response.StatusCode)
+	}
+
+	if !isJSON(data) && !bytes.Contains(data, []byte("<")) {
+		if data, err = decryptResponse(e.cipher, data); err != nil {
+			return err
+		}
+	}
+
+	ticketResponse := &TicketResponse{}
+	if err = e.decodePortalResponse(data, ticketResponse); err != nil {
+		return fmt.Errorf("%w: %v", ErrAlgoIDRejected, err)
+	}
+	if ticketResponse.Ticket == "" {
+		return ticketResponse.rejection()
+	}
+
+	e.Ticket = ticketResponse.Ticket
+	return nil
+}
+
+func (e *ESurfing) Login() error {
+	loginXML, err := e.GenerateLoginXML()
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	responseData, err := e.PostXML(e.AuthUrl, loginXML)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	loginResponseXML := &LoginResponse{}
+	err = e.decodePortalResponse(responseData, loginResponseXML)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	if loginResponseXML.KeepURL == "" {
+		return &PortalError{Code: loginResponseXML.Code, Message: loginResponseXML.Message}
+	}
+
+	e.KeepUrl = e.portalURL(loginResponseXML.KeepURL)
+	e.TermUrl = e.portalURL(loginResponseXML.TermURL)
+
+	if err = e.ScheduleHeartbeat(loginResponseXML.KeepRetry); err != nil {
+		e.Log.Println(err)
+	}
+	return nil
+}
+
+func (e *ESurfing) Heartbeat() error {
+	if e.KeepUrl == "" {
+		return errors.New("keep url is empty, auth may have failed")
+	}
+
+	stateXML, err := e.GenerateStateXML()
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	decrypted, err := e.PostXML(e.KeepUrl, stateXML)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	var stateResp StateResponse
+	if err := e.decodePortalResponse(decrypted, &stateResp); err != nil {
+		_ = e.ScheduleHeartbeat("")
+		return errors.New(err.Error())
+	}
+
+	// 门户已经接受了这次保活，间隔异常只需提示，不算作保活失败
+	if err = e.ScheduleHeartbeat(stateResp.Interval); err != nil {
+		e.Log.Println(err)
+	}
+	return nil
+}
+
+func (e *ESurfing) Logout() error {
+	if e.cipher == nil {
+		return nil
+	}
+
+	request, err := e.NewGetRequest(DetectURL)
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.Do(request)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		e.forgetSession()
+		return nil
+	}
+
+	stateXML, err := e.GenerateStateXML()
+	if err != nil {
+		return err
+	}
+
+	if _, err = e.PostXML(e.TermUrl, stateXML); err != nil {
+		return err
+	}
+
+	// 会话已经下线，下一次认证不必再把它当作残留会话
+	e.KeepUrl = ""
+	e.forgetSession()
+	e.Log.Println(T("log out request sent"))
+	return nil
+}
+
+// ImportSession 接管导出的会话，立即发送一次心跳确认会话仍然有效
+func (e *ESurfing) ImportSession(s *Session) error {
+	clientID, err := uuid.Parse(s.ClientID)
+	if err != nil {
+		return errors.New("invalid client id: " + s.ClientID)
+	}
+	cipher := NewCipher(s.AlgoID)
+	if cipher == nil {
+		return errors.New("Unknown AlgoID:" + s.AlgoID)
+	}
+	if s.KeepUrl == "" || s.Ticket == "" {
+		return errors.New("session has no keep url or ticket")
+	}
+
+	e.ResetSession()
+	e.cipher = cipher
+	e.ClientID = clientID
+	e.Hostname = s.Hostname
+	e.MacAddress = s.MacAddress
+	e.UserIP = s.UserIP
+	e.AcIP = s.AcIP
+	e.Domain = s.Domain
+	e.Area = s.Area
+	e.SchoolID = s.SchoolID
+	e.AlgoID = s.AlgoID
+	e.Ticket = s.Ticket
+	e.IndexUrl = s.IndexUrl
+	e.TicketUrl = s.TicketUrl
+	e.AuthUrl = s.AuthUrl
+	e.KeepUrl = s.KeepUrl
+	e.TermUrl = s.TermUrl
+	e.RedirectUrl = s.RedirectUrl
+
+	if err = e.Heartbeat(); err != nil {
+		e.ResetSession()
+		return fmt.Errorf("session is no longer valid: %v", err)
+	}
+	e.saveSession()
+	return nil
+}
+
+// KickSessions 向上一次登录留下的会话发送下线请求，释放其占用的设备数。
+// 本进程还没有登录过时使用 stateFile 中保存的会话，即上次运行崩溃前没有下线的会话
+func (e *ESurfing) KickSessions() error {
+	stale := e.staleSession
+	if stale == nil {
+		if stale = e.loadState().Session; stale != nil {
+			RegisterSecret(stale.Ticket)
+			e.forgetSession()
+		}
+	}
+	if stale == nil || stale.TermUrl == "" {
+		return errors.New("no stale session to terminate")
+	}
+	e.staleSession = nil
+	if stale.cipher == nil {
+		if stale.cipher = NewCipher(stale.AlgoID); stale.cipher == nil {
+			return errors.New("Unknown AlgoID:" + stale.AlgoID)
+		}
+	}
+
+	current := e.snapshot()
+	defer e.restore(current)
+	e.restore(stale)
+
+	stateXML, err := e.GenerateStateXML()
+	if err != nil {
+		return err
+	}
+
+	_, err = e.PostXML(e.TermUrl, stateXML)
+	return err
+}
+
+// saveSession 把刚登录的会话保存到 stateFile，失败只影响重启后下线残留会话
+func (e *ESurfing) saveSession() {
+	session := e.snapshot()
+	if err := e.updateState(func(s *AccountState) { s.Session = session }); err != nil {
+		e.Log.Printf(T("save session error: %v"), err)
+	}
+}
+
+// forgetSession 在会话下线后清除 stateFile 中保存的会话
+func (e *ESurfing) forgetSession() {
+	if e.loadState().Session == nil {
+		return
+	}
+	if err := e.updateState(func(s *AccountState) { s.Session = nil }); err != nil {
+		e.Log.Printf(T("save session error: %v"), err)
+	}
+}
+
+func (e *ESurfing) snapshot() *esurfingSession {
+	return &esurfingSession{
+		cipher:     e.cipher,
+		ClientID:   e.ClientID,
+		Hostname:   e.Hostname,
+		MacAddress: e.MacAddress,
+		UserIP:     e.UserIP,
+		Ticket:     e.Ticket,
+		AlgoID:     e.AlgoID,
+		TermUrl:    e.TermUrl,
+	}
+}
+
+func (e *ESurfing) restore(s *esurfingSession) {
+	e.cipher = s.cipher
+	e.ClientID = s.ClientID
+	e.Hostname = s.Hostname
+	e.MacAddress = s.MacAddress
+	e.UserIP = s.UserIP
+	e.Ticket = s.Ticket
+	e.AlgoID = s.AlgoID
+	e.TermUrl = s.TermUrl
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetTicketByQueryUsesEmulationOSTag(t *testing.T) {
+	var ostag string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ostag = r.URL.Query().Get("ostag")
+		_, _ = w.Write([]byte("<response><ticket>T1</ticket></response>"))
+	}))
+	defer server.Close()
+
+	e := NewESurfing(newTestClient(t, &Config{OSTag: "Windows"}))
+	e.Hostname = "random-host"
+	e.TicketUrl = server.URL + "/ticket"
+	if err := e.GetTicketByQuery(); err != nil {
+		t.Fatal(err)
+	}
+	if ostag != "Windows" {
+		t.Fatalf("ostag = %q, want the configured override", ostag)
+	}
+	if e.Ticket != "T1" {
+		t.Fatalf("ticket = %q", e.Ticket)
+	}
+}
+
+func TestPortalURL(t *testing.T) {
+	tests := []struct {
+		name, base, ref, want string
+	}{
+		{"empty", "https://portal.example/index", "", ""},
+		{"relative", "https://portal.example/a/index", "auth", "https://portal.example/a/auth"},
+		{"upgrade default port", "https://portal.example/index", "http://portal.example/keep", "https://portal.example/keep"},
+		{"upgrade explicit 80", "https://portal.example/index", "http://portal.example:80/keep", "https://portal.example/keep"},
+		{"keep explicit port", "https://portal.example/index", "http://portal.example:8080/keep", "http://portal.example:8080/keep"},
+		{"keep other host", "https://portal.example/index", "http://10.0.0.1/keep", "http://10.0.0.1/keep"},
+		{"keep http base", "http://portal.example/index", "http://portal.example/keep", "http://portal.example/keep"},
+		{"ipv6 upgrade", "https://[fd00::1]/index", "http://[fd00::1]:80/keep", "https://[fd00::1]/keep"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := NewESurfing(newTestClient(t, &Config{}))
+			e.IndexUrl = test.base
+			if got := e.portalURL(test.ref); got != test.want {
+				t.Errorf("portalURL(%q) = %q, want %q", test.ref, got, test.want)
+			}
+		})
+	}
+}
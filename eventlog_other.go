@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+func InstallEventSource(source string) error {
+	return errors.New("eventlog is only supported on windows")
+}
+
+func RemoveEventSource(source string) error {
+	return errors.New("eventlog is only supported on windows")
+}
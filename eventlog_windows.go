@@ -0,0 +1,212 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const NotifierEventLog = "eventlog"
+
+const (
+	eventlogErrorType       = 0x0001
+	eventlogWarningType     = 0x0002
+	eventlogInformationType = 0x0004
+)
+
+// 写入应用程序日志时使用的事件ID
+var eventLogIDs = map[string]uint32{
+	EventOnline:      1,
+	EventOffline:     2,
+	EventAuthFailed:  3,
+	EventLoggedOut:   4,
+	EventCircuitOpen: 5,
+}
+
+var (
+	advapi32                  = syscall.NewLazyDLL("advapi32.dll")
+	procRegisterEventSourceW  = advapi32.NewProc("RegisterEventSourceW")
+	procDeregisterEventSource = advapi32.NewProc("DeregisterEventSource")
+	procReportEventW          = advapi32.NewProc("ReportEventW")
+	procRegCreateKeyExW       = advapi32.NewProc("RegCreateKeyExW")
+	procRegSetValueExW        = advapi32.NewProc("RegSetValueExW")
+	procRegDeleteKeyW         = advapi32.NewProc("RegDeleteKeyW")
+)
+
+const (
+	defaultEventSource     = "Esurfing-go"
+	eventSourceKey         = `SYSTEM\CurrentControlSet\Services\EventLog\Application\`
+	eventCreateMessageFile = `%SystemRoot%\System32\EventCreate.exe`
+)
+
+var errEventSourceNotInstalled = errors.New("event source is not registered, run `eventlog install` as administrator")
+
+func init() {
+	notifierRegistry[NotifierEventLog] = func(cfg *NotifierConfig) (Notifier, error) {
+		return NewEventLogNotifier(cfg.Source)
+	}
+}
+
+// InstallEventSource 在 HKLM\...\EventLog\Application 下登记事件来源，需要管理员权限。
+// 消息文件使用系统自带的 EventCreate.exe，它为ID 1-1000 的事件提供"%1"格式，事件查看器可以直接显示消息内容
+func InstallEventSource(source string) error {
+	if source == "" {
+		source = defaultEventSource
+	}
+	key, err := syscall.UTF16PtrFromString(eventSourceKey + source)
+	if err != nil {
+		return err
+	}
+
+	var handle syscall.Handle
+	if ret, _, _ := procRegCreateKeyExW.Call(uintptr(syscall.HKEY_LOCAL_MACHINE), uintptr(unsafe.Pointer(key)), 0, 0, 0,
+		syscall.KEY_WRITE, 0, uintptr(unsafe.Pointer(&handle)), 0); ret != 0 {
+		return fmt.Errorf("create registry key for event source %s: %w", source, syscall.Errno(ret))
+	}
+	defer syscall.RegCloseKey(handle)
+
+	messageFile, err := syscall.UTF16FromString(eventCreateMessageFile)
+	if err != nil {
+		return err
+	}
+	if err = setRegistryValue(handle, "EventMessageFile", syscall.REG_EXPAND_SZ,
+		unsafe.Pointer(&messageFile[0]), uint32(len(messageFile)*2)); err != nil {
+		return err
+	}
+	types := uint32(eventlogErrorType | eventlogWarningType | eventlogInformationType)
+	if err = setRegistryValue(handle, "TypesSupported", syscall.REG_DWORD, unsafe.Pointer(&types), 4); err != nil {
+		return err
+	}
+	custom := uint32(1)
+	return setRegistryValue(handle, "CustomSource", syscall.REG_DWORD, unsafe.Pointer(&custom), 4)
+}
+
+// RemoveEventSource 删除 InstallEventSource 登记的事件来源
+func RemoveEventSource(source string) error {
+	if source == "" {
+		source = defaultEventSource
+	}
+	key, err := syscall.UTF16PtrFromString(eventSourceKey + source)
+	if err != nil {
+		return err
+	}
+	if ret, _, _ := procRegDeleteKeyW.Call(uintptr(syscall.HKEY_LOCAL_MACHINE), uintptr(unsafe.Pointer(key))); ret != 0 {
+		return fmt.Errorf("remove event source %s: %w", source, syscall.Errno(ret))
+	}
+	return nil
+}
+
+func setRegistryValue(key syscall.Handle, name string, valueType uint32, data unsafe.Pointer, size uint32) error {
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	if ret, _, _ := procRegSetValueExW.Call(uintptr(key), uintptr(unsafe.Pointer(namePtr)), 0,
+		uintptr(valueType), uintptr(data), uintptr(size)); ret != 0 {
+		return fmt.Errorf("set registry value %s: %w", name, syscall.Errno(ret))
+	}
+	return nil
+}
+
+// eventSourceInstalled 检查事件来源是否已经登记，没有登记时事件查看器无法显示消息内容
+func eventSourceInstalled(source string) bool {
+	key, err := syscall.UTF16PtrFromString(eventSourceKey + source)
+	if err != nil {
+		return false
+	}
+	var handle syscall.Handle
+	if syscall.RegOpenKeyEx(syscall.HKEY_LOCAL_MACHINE, key, 0, syscall.KEY_READ, &handle) != nil {
+		return false
+	}
+	_ = syscall.RegCloseKey(handle)
+	return true
+}
+
+// EventLogNotifier 把事件写入Windows应用程序日志，方便机房用现有的日志收集工具采集。
+// 句柄在第一次写入时才打开，只做配置检查的客户端(config validate、init)不会占用句柄
+type EventLogNotifier struct {
+	source string
+
+	mu     sync.Mutex
+	handle uintptr
+}
+
+func NewEventLogNotifier(source string) (*EventLogNotifier, error) {
+	if source == "" {
+		source = defaultEventSource
+	}
+	if _, err := syscall.UTF16PtrFromString(source); err != nil {
+		return nil, err
+	}
+	return &EventLogNotifier{source: source}, nil
+}
+
+func (n *EventLogNotifier) open() (uintptr, error) {
+	if n.handle != 0 {
+		return n.handle, nil
+	}
+	if !eventSourceInstalled(n.source) {
+		return 0, errEventSourceNotInstalled
+	}
+	name, _ := syscall.UTF16PtrFromString(n.source)
+	handle, _, err := procRegisterEventSourceW.Call(0, uintptr(unsafe.Pointer(name)))
+	if handle == 0 {
+		return 0, err
+	}
+	n.handle = handle
+	return handle, nil
+}
+
+// Close 释放事件日志句柄，客户端停止时调用
+func (n *EventLogNotifier) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.handle == 0 {
+		return nil
+	}
+	_, _, _ = procDeregisterEventSource.Call(n.handle)
+	n.handle = 0
+	return nil
+}
+
+func (n *EventLogNotifier) Notify(event *Event) error {
+	eventType := uint16(eventlogInformationType)
+	switch event.Type {
+	case EventAuthFailed:
+		eventType = eventlogErrorType
+	case EventOffline, EventCircuitOpen:
+		eventType = eventlogWarningType
+	}
+
+	message := event.Type + " user=" + event.Username + " interface=" + event.Interface
+	if event.IP != "" {
+		message += " ip=" + event.IP
+	}
+	if event.Code != "" {
+		message += " code=" + event.Code
+	}
+	message += ": " + event.Message
+
+	text, err := syscall.UTF16PtrFromString(message)
+	if err != nil {
+		return err
+	}
+	strs := []*uint16{text}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	handle, err := n.open()
+	if err != nil {
+		return err
+	}
+	ret, _, err := procReportEventW.Call(handle, uintptr(eventType), 0, uintptr(eventLogIDs[event.Type]),
+		0, 1, 0, uintptr(unsafe.Pointer(&strs[0])), 0)
+	if ret == 0 {
+		return err
+	}
+	return nil
+}
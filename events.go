@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// Subscribe 订阅客户端的状态事件：认证成功(online)、认证失败(auth_failed，Code为门户错误码)、
+// 掉线(offline)、心跳成功/失败和主动下线(logged_out)。订阅者处理不及时时事件会被丢弃，
+// 调用返回的函数取消订阅并关闭通道。
+// 这是进程内部的接口，供事件钩子、MQTT等模块使用；本项目是 main 包，不能被其他程序导入，
+// 外部程序请使用通知(webhook)、事件钩子、MQTT或 /logs 获取这些事件
+func (c *Client) Subscribe(buffer int) (<-chan *Event, func()) {
+	ch := make(chan *Event, buffer)
+
+	c.subMu.Lock()
+	if c.subscribers == nil {
+		c.subscribers = map[chan *Event]struct{}{}
+	}
+	c.subscribers[ch] = struct{}{}
+	c.subMu.Unlock()
+
+	return ch, func() {
+		c.subMu.Lock()
+		defer c.subMu.Unlock()
+		if _, ok := c.subscribers[ch]; ok {
+			delete(c.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Emit 补全事件的账号信息后发给所有订阅者和通知器。事件会离开进程(webhook、钩子、MQTT等)，
+// 消息在这里统一打码，调用者不必各自处理
+func (c *Client) Emit(event *Event) {
+	event.Message = Redact(event.Message)
+	status := c.Status()
+	event.Username = c.Config.Username
+	event.Interface = status.Interface
+	if event.IP == "" {
+		event.IP = status.UserIP
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	c.subMu.Lock()
+	for ch := range c.subscribers {
+		e := *event
+		select {
+		case ch <- &e:
+		default:
+		}
+	}
+	c.subMu.Unlock()
+
+	c.notifyEvent(event)
+}
+
+// emitError 发布带错误信息的事件，门户拒绝时附上错误码
+func (c *Client) emitError(eventType string, err error) {
+	event := &Event{Type: eventType, Message: RedactError(err)}
+	var portalErr *PortalError
+	if errors.As(err, &portalErr) {
+		event.Code = portalErr.Code
+	}
+	c.Emit(event)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	FailureLinkDown           = "link down"
+	FailureGatewayUnreachable = "gateway unreachable"
+	FailurePortalDown         = "portal down"
+)
+
+// NetworkError 是检测失败时按网关可达性归类后的错误
+type NetworkError struct {
+	Class   string
+	Gateway string
+	Err     error
+}
+
+func (e *NetworkError) Error() string {
+	if e.Gateway != "" {
+		return T(e.Class) + " (gateway " + e.Gateway + "): " + e.Err.Error()
+	}
+	return T(e.Class) + ": " + e.Err.Error()
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// ClassifyFailure 探测网关，区分链路断开、局域网不通和门户/上游故障
+func (c *Client) ClassifyFailure(err error) error {
+	iFace := c.Config.BindInterface
+	if c.Config.BindIP != "" {
+		name, ipErr := interfaceByIP(net.ParseIP(c.Config.BindIP))
+		if ipErr != nil {
+			return &NetworkError{Class: FailureLinkDown, Err: ipErr}
+		}
+		iFace = name
+	} else if iFace != "" {
+		if _, ipErr := GetInterfaceIP(iFace); ipErr != nil {
+			return &NetworkError{Class: FailureLinkDown, Err: ipErr}
+		}
+	}
+
+	gateway, gwErr := GetDefaultGateway(iFace)
+	if gwErr != nil {
+		return &NetworkError{Class: FailureLinkDown, Err: errors.Join(err, gwErr)}
+	}
+
+	if !c.GatewayReachable(gateway) {
+		return &NetworkError{Class: FailureGatewayUnreachable, Gateway: gateway, Err: err}
+	}
+
+	return &NetworkError{Class: FailurePortalDown, Gateway: gateway, Err: err}
+}
+
+// GatewayReachable 向网关发起TCP连接，连接成功或被拒绝都说明网关在线
+func (c *Client) GatewayReachable(gateway string) bool {
+	if arpResolved(gateway) {
+		return true
+	}
+
+	control, _ := bindControl(c.Config)
+	dialer := &net.Dialer{Timeout: 2 * time.Second, Control: control}
+	if c.Config.BindIP != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(c.Config.BindIP)}
+	} else if c.Config.BindInterface != "" {
+		if ip, err := GetInterfaceIP(c.Config.BindInterface); err == nil {
+			dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(ip)}
+		}
+	}
+
+	conn, err := dialer.DialContext(c.Ctx, "tcp", net.JoinHostPort(gateway, "80"))
+	if err == nil {
+		_ = conn.Close()
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNREFUSED) || strings.Contains(err.Error(), "refused")
+}
@@ -0,0 +1,90 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+// GetDefaultGateway 从 /proc/net/route 读取默认网关，指定网卡时只看该网卡的路由
+func GetDefaultGateway(interfaceName string) (string, error) {
+	file, err := os.Open("/proc/net/route")
+	if err != nil {
+		return "", err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		if interfaceName != "" && fields[0] != interfaceName {
+			continue
+		}
+
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(raw))
+		return ip.String(), nil
+	}
+
+	return "", errors.New("no default route")
+}
+
+// DefaultRouteInterface 返回持有默认路由的网卡名称
+func DefaultRouteInterface() (string, error) {
+	file, err := os.Open("/proc/net/route")
+	if err != nil {
+		return "", err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[1] == "00000000" {
+			return fields[0], nil
+		}
+	}
+
+	return "", errors.New("no default route")
+}
+
+// arpResolved 判断网关是否已经在 ARP 表中完成解析
+func arpResolved(gateway string) bool {
+	_, err := GatewayMAC(gateway)
+	return err == nil
+}
+
+// GatewayMAC 从 /proc/net/arp 读取网关的MAC地址
+func GatewayMAC(gateway string) (string, error) {
+	data, err := os.ReadFile("/proc/net/arp")
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 4 && fields[0] == gateway && fields[2] == "0x2" && fields[3] != "00:00:00:00:00:00" {
+			return fields[3], nil
+		}
+	}
+	return "", errors.New("gateway not in arp table: " + gateway)
+}
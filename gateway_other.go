@@ -0,0 +1,140 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// GetDefaultGateway 通过系统 route 命令获取默认网关
+func GetDefaultGateway(interfaceName string) (string, error) {
+	if runtime.GOOS == "windows" {
+		return windowsDefaultGateway(interfaceName)
+	}
+
+	args := []string{"-n", "get", "default"}
+	if interfaceName != "" {
+		args = append(args, "-ifscope", interfaceName)
+	}
+	out, err := exec.Command("route", args...).Output()
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if ok && key == "gateway" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", errors.New("no default route")
+}
+
+// DefaultRouteInterface 返回持有默认路由的网卡名称
+func DefaultRouteInterface() (string, error) {
+	if runtime.GOOS == "windows" {
+		return windowsDefaultRouteInterface()
+	}
+
+	out, err := exec.Command("route", "-n", "get", "default").Output()
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if ok && key == "interface" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", errors.New("no default route")
+}
+
+// windowsDefaultRouteInterface 通过默认路由的本地地址找到对应的网卡
+func windowsDefaultRouteInterface() (string, error) {
+	out, err := exec.Command("route", "print", "-4", "0.0.0.0").Output()
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "0.0.0.0" || fields[1] != "0.0.0.0" {
+			continue
+		}
+		ip := net.ParseIP(fields[3])
+		if ip == nil {
+			continue
+		}
+		return interfaceByIP(ip)
+	}
+	return "", errors.New("no default route")
+}
+
+func windowsDefaultGateway(interfaceName string) (string, error) {
+	var localIP string
+	if interfaceName != "" {
+		ip, err := GetInterfaceIP(interfaceName)
+		if err != nil {
+			return "", err
+		}
+		localIP = ip
+	}
+
+	out, err := exec.Command("route", "print", "-4", "0.0.0.0").Output()
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "0.0.0.0" || fields[1] != "0.0.0.0" {
+			continue
+		}
+		if net.ParseIP(fields[2]) == nil {
+			continue
+		}
+		if localIP != "" && fields[3] != localIP {
+			continue
+		}
+		return fields[2], nil
+	}
+	return "", errors.New("no default route")
+}
+
+func arpResolved(gateway string) bool {
+	return false
+}
+
+// GatewayMAC 通过系统 arp 命令读取网关的MAC地址
+func GatewayMAC(gateway string) (string, error) {
+	args := []string{"-n", gateway}
+	if runtime.GOOS == "windows" {
+		args = []string{"-a", gateway}
+	}
+	out, err := exec.Command("arp", args...).Output()
+	if err != nil {
+		return "", err
+	}
+
+	// Windows 输出 00-11-22-33-44-55，macOS 输出省略前导0的 0:11:22:33:44:55
+	for _, field := range strings.Fields(string(out)) {
+		parts := strings.FieldsFunc(field, func(r rune) bool { return r == ':' || r == '-' })
+		if len(parts) != 6 {
+			continue
+		}
+		for i, part := range parts {
+			if len(part) == 1 {
+				parts[i] = "0" + part
+			}
+		}
+		if mac, err := net.ParseMAC(strings.Join(parts, ":")); err == nil {
+			return mac.String(), nil
+		}
+	}
+	return "", errors.New("gateway not in arp table: " + gateway)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// Group 等待一组 goroutine 结束并汇总它们返回的错误，用法同 errgroup.Group(不带 WithContext)。
+// errgroup.Group 的 Wait 只返回第一个错误，这里用 errors.Join 返回所有客户端的错误，
+// 多个账号同时因密码错误等原因停止时每个都能报告出来，也不需要为此引入 golang.org/x/sync
+type Group struct {
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+// Go 在新的 goroutine 中运行 fn，fn 返回的非空错误会在 Wait 时返回
+func (g *Group) Go(fn func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := fn(); err != nil {
+			g.mu.Lock()
+			g.errs = append(g.errs, err)
+			g.mu.Unlock()
+		}
+	}()
+}
+
+// Wait 等待所有 goroutine 结束，返回期间收集到的全部错误并清空，之后 Group 可以复用
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	err := errors.Join(g.errs...)
+	g.errs = nil
+	return err
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGroupJoinsAllErrors(t *testing.T) {
+	errA, errB := errors.New("a"), errors.New("b")
+	var g Group
+	g.Go(func() error { return errA })
+	g.Go(func() error { return nil })
+	g.Go(func() error { return errB })
+
+	err := g.Wait()
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Fatalf("Wait() = %v, want both errors", err)
+	}
+	if err = g.Wait(); err != nil {
+		t.Fatalf("second Wait() = %v, want nil after reset", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const hookTimeout = 30 * time.Second
+
+// hookScript 返回事件对应的脚本
+func (c *Client) hookScript(eventType string) string {
+	switch eventType {
+	case EventOnline:
+		return c.Config.OnOnline
+	case EventOffline:
+		return c.Config.OnOffline
+	case EventAuthFailed:
+		return c.Config.OnAuthFail
+	}
+	return ""
+}
+
+func (c *Client) hasHooks() bool {
+	return c.Config.OnOnline != "" || c.Config.OnOffline != "" || c.Config.OnAuthFail != ""
+}
+
+// runHooks 依次执行状态变化对应的脚本，事件信息通过环境变量传入
+func (c *Client) runHooks(events <-chan *Event) {
+	for {
+		select {
+		case <-c.Ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if script := c.hookScript(event.Type); script != "" {
+				c.runHook(script, event)
+			}
+		}
+	}
+}
+
+func (c *Client) runHook(script string, event *Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", script)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", script)
+	}
+
+	var errMessage string
+	if event.Type == EventAuthFailed || event.Type == EventOffline {
+		errMessage = event.Message
+	}
+	cmd.Env = append(os.Environ(),
+		"ESURFING_EVENT="+event.Type,
+		"ESURFING_USERNAME="+event.Username,
+		"ESURFING_INTERFACE="+event.Interface,
+		"ESURFING_IP="+event.IP,
+		"ESURFING_ERROR="+errMessage,
+		"ESURFING_CODE="+event.Code,
+		"ESURFING_TIME="+event.Time.Format(time.RFC3339),
+	)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		c.Log.Printf(T("hook %s failed: %v %s"), event.Type, err, strings.TrimSpace(string(out)))
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"strings"
+)
+
+const (
+	LocaleEN = "en"
+	LocaleZH = "zh"
+)
+
+var locale = LocaleEN
+
+// zhMessages 以英文原文为键的中文翻译，格式化占位符需与原文一致
+var zhMessages = map[string]string{
+	"WARNING: TLS certificate verification is DISABLED for portal requests, anyone on the path can impersonate the portal": "警告: 门户请求已关闭TLS证书校验，同一网络中的任何人都可以冒充门户",
+	"last message repeated %d times: %s": "上一条日志重复了 %d 次: %s",
+	"Network check failed:%v":            "网络检测失败:%v",
+	"algo_id:":                           "加密算法:",
+	"auth failed: %v":                    "认证失败: %v",
+	"auth finished":                      "认证完成",
+	"account already online, terminating stale session: %v":         "账号已在线，正在下线残留会话: %v",
+	"auth rejected by device limit, terminating other sessions: %v": "在线设备数已达上限，尝试下线其他会话: %v",
+	"auth required (page redirect)":                                 "需要认证(页面跳转)",
+	"no redirect from detection, discovered portal %s":              "检测未得到重定向，发现门户 %s",
+	"auth required":                               "需要认证",
+	"client context cancel":                       "客户端已停止",
+	"client stopped: %v":                          "客户端已停止：%v",
+	"clients stopped with errors: %v":             "以下客户端因错误停止：%v",
+	"replaying %d exchanges from:%s":              "从%[2]s回放%[1]d条记录",
+	"replay finished, %d exchanges not requested": "回放结束，%d条记录未被请求",
+	"recording portal exchanges to:":              "录制门户交互到：",
+	"WARNING: -unsafe-debug is set, passwords and tickets will appear in logs and status output": "警告：已开启-unsafe-debug，密码和ticket会完整出现在日志和状态输出中",
+	"challenge expired, fetching a new ticket: %v":                                               "挑战值已过期，重新获取ticket：%v",
+	"challenge expired, fetching a new challenge: %v":                                            "挑战值已过期，重新获取challenge：%v",
+	"ticket rejected, retry with algo_id %s: %v":                                                 "获取ticket被拒绝，改用algo_id %s重试：%v",
+	"save algo id error: %v":                                                                     "保存algo_id出错：%v",
+	"algo_id %s saved to %s":                                                                     "algo_id %s已保存到%s",
+	"network change reported, checking now":                                                      "收到网络变化通知，立即检测",
+	"NetworkManager: %s, checking now":                                                           "NetworkManager：%s，立即检测",
+	"watch NetworkManager:":                                                                      "监听NetworkManager失败：",
+	"watching NetworkManager over D-Bus":                                                         "已通过D-Bus监听NetworkManager",
+	"NetworkManager watcher error: %v, reconnecting in %v":                                       "监听NetworkManager出错：%v，%v 后重连",
+	"read wifi ssid error: %v":                                                                   "读取无线网络名称出错：%v",
+	"wifi %q is not a campus network, detection paused":                                          "无线网络%q不是校园网，暂停检测",
+	"connected to campus wifi %q, checking now":                                                  "已连接校园网%q，立即检测",
+	"not connected to wifi, detection paused":                                                    "未连接无线网络，暂停检测",
+	"portal failing (%d of last %d calls), circuit open, probing every %v: %v":                   "门户请求连续失败(最近%[2]d次中%[1]d次)，已熔断，每隔%[3]v探测一次: %[4]v",
+	"portal still failing after recovery, circuit open again, probing every %v: %v":              "门户恢复后认证仍然失败，重新熔断，每隔%v探测一次: %v",
+	"portal still unreachable, next probe at %s: %v":                                             "门户仍不可用，下次探测时间 %s: %v",
+	"portal reachable again, trying a full authentication":                                       "门户已可以访问，尝试完整认证",
+	"portal recovered, circuit closed":                                                           "门户已恢复，解除熔断",
+	"network matches profile %s, using account %s":                                               "当前网络匹配账号配置 %s，使用账号 %s",
+	"no profile matches the current network, using the default account":                          "当前网络没有匹配的账号配置，使用默认账号",
+	"logging out account %s before switching profiles":                                           "切换账号配置前先下线账号 %s",
+	"mqtt error: %v, reconnecting in %v":                                                         "MQTT错误: %v，%v 后重连",
+	"mqtt connected:":                                                                            "已连接MQTT:",
+	"mqtt relogin requested for %s":                                                              "收到MQTT重新认证请求: %s",
+	"publish state to mqtt:":                                                                     "发布状态到MQTT:",
+	"http api on %s has no token, anyone on the network can read the status":                     "HTTP接口 %s 没有设置令牌，同网络的任何人都可以读取状态",
+	"client start":                                                "客户端启动",
+	"WISPr location:":                                             "WISPr热点位置:",
+	"control socket:":                                             "控制socket:",
+	"dns answer hijacked to %s":                                   "域名解析被劫持到 %s",
+	"exit":                                                        "退出",
+	"forced re-authentication requested":                          "收到强制重新认证请求",
+	"hook %s failed: %v %s":                                       "执行%s脚本失败: %v %s",
+	"export traces error: %v":                                     "导出trace失败: %v",
+	"watchdog: %s, restarting client":                             "看门狗: %s，重启该账号",
+	"watchdog: goroutine dump:\n%s":                               "看门狗: goroutine 调用栈:\n%s",
+	"watchdog: restart failed: %v":                                "看门狗: 重启失败: %v",
+	"client %s restarted by watchdog":                             "账号 %s 已被看门狗重启",
+	"push metrics to:":                                            "推送指标到:",
+	"push metrics error: %v":                                      "推送指标失败: %v",
+	"http listen:":                                                "HTTP监听:",
+	"http server error: %v":                                       "HTTP服务错误: %v",
+	"load %d from:%s":                                             "从%[2]s读取了%[1]d个账号",
+	"macvlan %s created on %s with mac %s":                        "已在%[2]s上创建macvlan %[1]s，MAC为%[3]s",
+	"macvlan %s got address %s":                                   "macvlan %s 获取到地址 %s",
+	"remove macvlan %s failed: %v %s":                             "删除macvlan %s失败: %v %s",
+	"macvlan %s removed":                                          "已删除macvlan %s",
+	"log out request sent":                                        "已发送下线请求",
+	"logout error: %v":                                            "下线失败: %v",
+	"logout requested, network check paused until relogin":        "收到下线请求，暂停检测直到重新登录",
+	"delivering %d notifications queued while offline":            "补发离线期间缓存的 %d 条通知",
+	"notification queue full, drop event:":                        "通知队列已满，丢弃事件:",
+	"notify %s error: %v":                                         "发送%s通知失败: %v",
+	"portal changed from %s to %s, re-bootstrapping":              "门户由 %s 变为 %s，重新获取门户信息",
+	"read %s error: %v":                                           "读取%s失败: %v",
+	"save fingerprint error: %v":                                  "保存设备标识失败: %v",
+	"save client id error: %v":                                    "保存ClientID失败: %v",
+	"save session error: %v":                                      "保存会话失败: %v",
+	"reading config":                                              "读取配置",
+	"reload %d from:%s":                                           "从%[2]s重新读取了%[1]d个账号",
+	"reload failed, restore previous config: %v":                  "重新加载失败，恢复之前的配置: %v",
+	"relogin requested":                                           "收到重新登录请求",
+	"request %s failed: %v, retry in %v":                          "请求%s失败: %v，%v后重试",
+	"restore previous config failed: %v":                          "恢复之前的配置失败: %v",
+	"session import failed: %v":                                   "导入会话失败: %v",
+	"session imported, heartbeat resumed":                         "已导入会话，继续保活",
+	"%d consecutive heartbeats failed, re-authenticating":         "连续 %d 次保活失败，重新认证",
+	"session traffic: received %s, sent %s":                       "本次会话流量: 接收 %s，发送 %s",
+	"less than %d bytes in %v, logging out until traffic resumes": "%[2]v 内流量不足 %[1]d 字节，下线直到有流量时再认证",
+	"traffic resumed, re-authenticating":                          "检测到流量，重新认证",
+	"send udp heartbeat error: %v":                                "发送UDP保活失败: %v",
+	"send heartbeat error: %v":                                    "发送心跳失败: %v",
+	"send heartbeat":                                              "发送心跳",
+	"srun login:":                                                 "深澜登录:",
+	"srun portal:":                                                "深澜门户:",
+	"status:":                                                     "状态:",
+	"stoping all clients":                                         "正在停止所有客户端",
+	"terminate sessions failed: %v":                               "下线其他会话失败: %v",
+	"get ticket by POST failed, retry with GET: %v":               "POST获取ticket失败，改用GET: %v",
+	"ticket:":                     "票据:",
+	"write status file error: %v": "写入状态文件失败: %v",
+
+	"%s already exists, overwrite?":                                "%s 已存在，是否覆盖?",
+	"probing for the campus portal...":                             "正在探测校园网门户...",
+	"probe failed: %v":                                             "探测失败: %v",
+	"no portal redirect, the network may already be authenticated": "没有跳转到门户，网络可能已经认证",
+	"found portal %s (%s)":                                         "发现门户 %s (%s)",
+	"username":                                                     "账号",
+	"password":                                                     "密码",
+	"config written to %s":                                         "配置已写入 %s",
+	"interface number, empty for system default":                   "网卡序号，留空使用系统默认",
+	"heartbeat interval %ds out of range, clamped to %v":           "保活间隔 %d 秒超出范围，改为 %v",
+	"invalid heartbeat interval %q, fallback to %dms":              "无效的心跳间隔 %q，使用默认值 %dms",
+	"portal under maintenance:":                                    "门户维护中:",
+	"portal under maintenance, next attempt in %v: %v":             "门户维护中，%v 后再尝试: %v",
+	"portal rejected auth:":                                        "门户拒绝认证:",
+	FailureLinkDown:                                                "链路断开",
+	FailureGatewayUnreachable:                                      "网关不可达",
+	FailurePortalDown:                                              "门户不可用",
+}
+
+// T 返回当前语言下的日志文本，没有翻译时原样返回
+func T(msg string) string {
+	if locale == LocaleZH {
+		if translated, ok := zhMessages[msg]; ok {
+			return translated
+		}
+	}
+	return msg
+}
+
+func SetLocale(l string) {
+	if l == LocaleZH || strings.HasPrefix(strings.ToLower(l), "zh") {
+		locale = LocaleZH
+		return
+	}
+	locale = LocaleEN
+}
+
+// portalMessages 门户常见的错误码/错误信息及其中英文解释
+var portalMessages = []struct {
+	Match string
+	ZH    string
+	EN    string
+}{
+	{"E2531", "用户不存在", "user not found"},
+	{"E2532", "两次认证间隔太短", "authentication too frequent"},
+	{"E2533", "密码错误次数超过限制", "too many wrong passwords"},
+	{"E2553", "密码错误", "wrong password"},
+	{"E2601", "不是专用客户端", "client not allowed"},
+	{"E2606", "用户被禁用", "account disabled"},
+	{"E2611", "非该账号绑定设备", "device not bound to account"},
+	{"E2613", "NAS PORT绑定错误", "NAS port binding mismatch"},
+	{"E2614", "MAC地址绑定错误", "MAC address binding mismatch"},
+	{"E2616", "用户已欠费", "account in arrears"},
+	{"E2620", "已经在线了", "already online"},
+	{"E2621", "已经达到授权人数", "license limit reached"},
+	{"E2833", "IP地址异常", "invalid IP address"},
+	{"E2901", "第三方认证失败", "third party authentication failed"},
+	{"ip_already_online_error", "该IP已在线", "IP already online"},
+	{"sign_error", "签名错误", "signature error"},
+	{"用户不存在", "用户不存在", "user not found"},
+	{"密码错误", "密码错误", "wrong password"},
+	{"欠费", "账号已欠费", "account in arrears"},
+	{"停机", "账号已停机", "account suspended"},
+	{"在线数", "在线设备数已达上限", "online device limit reached"},
+	{"终端数", "在线设备数已达上限", "online device limit reached"},
+	{"设备数", "在线设备数已达上限", "online device limit reached"},
+}
+
+// TranslatePortalMessage 为门户返回的错误附上当前语言的解释
+func TranslatePortalMessage(code string, message string) string {
+	text := strings.TrimSpace(code + " " + message)
+	for _, m := range portalMessages {
+		if !strings.Contains(text, m.Match) {
+			continue
+		}
+		explain := m.EN
+		if locale == LocaleZH {
+			explain = m.ZH
+		}
+		if strings.Contains(text, explain) {
+			return text
+		}
+		return text + " (" + explain + ")"
+	}
+	return text
+}
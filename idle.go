@@ -0,0 +1,68 @@
+package main
+
+import (
+	"time"
+)
+
+// idleState 记录空闲检测的窗口：窗口内会话流量低于 idle_threshold 且持续 idle_timeout 时自动下线
+type idleState struct {
+	windowStart time.Time
+	windowBytes uint64
+	// base 为空闲下线时网卡的累计收发字节数，之后的流量超过阈值视为有上网需求
+	base uint64
+}
+
+func (c *Client) idleEnabled() bool {
+	return c.Config.IdleTimeout > 0
+}
+
+// checkIdle 在已认证时调用，流量持续低于阈值超过 idle_timeout 时下线并进入空闲状态
+func (c *Client) checkIdle() {
+	s := c.Status()
+	if !c.idleEnabled() || !s.Online || c.traffic == nil {
+		c.idle.windowStart = time.Time{}
+		return
+	}
+
+	total := s.SessionRxBytes + s.SessionTxBytes
+	now := time.Now()
+	if c.idle.windowStart.IsZero() || total-c.idle.windowBytes >= uint64(c.Config.IdleThreshold) {
+		c.idle.windowStart = now
+		c.idle.windowBytes = total
+		return
+	}
+	if now.Sub(c.idle.windowStart) < time.Millisecond*time.Duration(c.Config.IdleTimeout) {
+		return
+	}
+
+	iFace := c.traffic.iFace
+	c.Log.Printf(T("less than %d bytes in %v, logging out until traffic resumes"), c.Config.IdleThreshold, now.Sub(c.idle.windowStart).Round(time.Second))
+	c.goOffline("idle")
+	c.stopHeartbeat()
+	c.Logout()
+	c.setOnline(false)
+	c.idle.windowStart = time.Time{}
+
+	rx, tx, err := InterfaceCounters(iFace)
+	if err != nil {
+		return
+	}
+	c.idle.base = rx + tx
+	c.setIdle(true, iFace)
+}
+
+// idleDemand 空闲下线后，网卡上的流量(下游设备尝试上网)超过阈值时返回 true
+func (c *Client) idleDemand() bool {
+	rx, tx, err := InterfaceCounters(c.Status().IdleInterface)
+	if err != nil {
+		return true
+	}
+	return rx+tx < c.idle.base || rx+tx-c.idle.base >= uint64(c.Config.IdleThreshold)
+}
+
+func (c *Client) setIdle(idle bool, iFace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.Idle = idle
+	c.status.IdleInterface = iFace
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// repeatReportInterval 是重复日志汇总输出的最短间隔
+const repeatReportInterval = 10 * time.Minute
+
+// LogDeduper 合并连续重复的日志，只定期输出一条带次数的汇总，避免同一错误每轮检测都刷屏
+type LogDeduper struct {
+	last  string
+	count int
+	since time.Time
+}
+
+// Print 输出一条日志，与上一条相同时只计数
+func (d *LogDeduper) Print(l *log.Logger, message string) {
+	if message == d.last {
+		d.count++
+		if time.Since(d.since) >= repeatReportInterval {
+			d.Flush(l)
+			d.last = message
+		}
+		return
+	}
+
+	d.Flush(l)
+	l.Print(message)
+	d.last = message
+	d.since = time.Now()
+}
+
+// Flush 输出尚未汇总的重复次数，并忘记上一条日志
+func (d *LogDeduper) Flush(l *log.Logger) {
+	if d.count > 0 {
+		l.Printf(T("last message repeated %d times: %s"), d.count, d.last)
+	}
+	d.last = ""
+	d.count = 0
+	d.since = time.Now()
+}
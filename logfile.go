@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// LogPrefix 生成账号日志的前缀。未配置 log_tag 时使用默认的 [rid][user:... bind_device:...] 格式，
+// log_fields 按键名排序追加在其后；配置后按模板替换 {rid} {name} {username} {username_tail}(账号后4位)
+// {interface} 以及 log_fields 中的 {键名}，name 未配置时等于账号
+func LogPrefix(c *Config, rid string, iface string) string {
+	keys := make([]string, 0, len(c.LogFields))
+	for key := range c.LogFields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	if c.LogTag == "" {
+		fields := ""
+		for _, key := range keys {
+			fields += " " + key + ":" + c.LogFields[key]
+		}
+		return "[" + rid + "][user:" + c.Username + " bind_device:" + iface + fields + "] "
+	}
+
+	name := c.Name
+	if name == "" {
+		name = c.Username
+	}
+	tail := c.Username
+	if len(tail) > 4 {
+		tail = tail[len(tail)-4:]
+	}
+	pairs := []string{
+		"{rid}", rid,
+		"{name}", name,
+		"{username}", c.Username,
+		"{username_tail}", tail,
+		"{interface}", iface,
+	}
+	for _, key := range keys {
+		pairs = append(pairs, "{"+key+"}", c.LogFields[key])
+	}
+	return strings.NewReplacer(pairs...).Replace(c.LogTag) + " "
+}
+
+// OpenLogFile 按 log_file 模板打开账号自己的日志文件，{username} 和 {interface} 会被替换，
+// 未配置时返回nil，日志输出到标准输出
+func OpenLogFile(c *Config) (*os.File, error) {
+	if c.LogFile == "" {
+		return nil, nil
+	}
+
+	path := strings.NewReplacer(
+		"{username}", c.Username,
+		"{interface}", c.BindInterface,
+	).Replace(c.LogFile)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create log directory: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open log file: %v", err)
+	}
+	return file, nil
+}
+
+func (c *Client) closeLog() {
+	if c.logFile != nil {
+		_ = c.logFile.Close()
+	}
+}
+
+// discard 释放创建后没有运行的客户端占用的资源
+func (c *Client) discard() {
+	c.Cancel()
+	c.closeLog()
+}
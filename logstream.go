@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogEvent 是推送给 /logs 订阅者的一条日志，Message 已打码
+type LogEvent struct {
+	Time     time.Time `json:"time"`
+	Level    string    `json:"level"`
+	Username string    `json:"username,omitempty"`
+	Message  string    `json:"message"`
+
+	level int
+}
+
+var levelNames = map[int]string{levelInfo: "info", levelWarn: "warn", levelError: "error"}
+
+// logTimeLayout 是 log.LstdFlags 输出的时间格式
+const logTimeLayout = "2006/01/02 15:04:05"
+
+// logBacklogSize 是保留的最近日志条数，新连接的订阅者可以先收到这些日志
+const logBacklogSize = 200
+
+// LogHub 把所有日志分发给当前的订阅者，订阅者处理不过来时丢弃而不是阻塞日志输出
+type LogHub struct {
+	mu          sync.Mutex
+	backlog     []*LogEvent
+	subscribers map[chan *LogEvent]struct{}
+}
+
+var logHub = &LogHub{subscribers: map[chan *LogEvent]struct{}{}}
+
+// Writer 返回把 log.Logger 的输出转为 LogEvent 的 io.Writer，prefix 为该 Logger 的前缀，会从消息中去掉
+func (h *LogHub) Writer(username string, prefix string) io.Writer {
+	return &logTapWriter{hub: h, username: username, prefix: prefix}
+}
+
+// Subscribe 返回接收新日志的通道和订阅时已有的最近 tail 条日志
+func (h *LogHub) Subscribe(tail int) (chan *LogEvent, []*LogEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan *LogEvent, 64)
+	h.subscribers[ch] = struct{}{}
+	tail = min(max(tail, 0), len(h.backlog))
+	return ch, append([]*LogEvent(nil), h.backlog[len(h.backlog)-tail:]...)
+}
+
+func (h *LogHub) Unsubscribe(ch chan *LogEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, ch)
+}
+
+func (h *LogHub) publish(event *LogEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.backlog = append(h.backlog, event)
+	if len(h.backlog) > logBacklogSize {
+		h.backlog = h.backlog[len(h.backlog)-logBacklogSize:]
+	}
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+type logTapWriter struct {
+	hub      *LogHub
+	username string
+	prefix   string
+}
+
+func (w *logTapWriter) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	// 去掉 log.LstdFlags 的时间，事件自带时间
+	if len(line) > len(logTimeLayout) {
+		if _, err := time.Parse(logTimeLayout, line[:len(logTimeLayout)]); err == nil {
+			line = line[len(logTimeLayout)+1:]
+		}
+	}
+	level := logLevel(p)
+	w.hub.publish(&LogEvent{
+		Time:     time.Now(),
+		Level:    levelNames[level],
+		Username: w.username,
+		Message:  Redact(strings.TrimPrefix(line, w.prefix)),
+		level:    level,
+	})
+	return len(p), nil
+}
+
+// websocketGUID 是 RFC 6455 握手中固定拼接的值
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// handleLogs 通过WebSocket实时推送日志，每条为一个JSON文本帧。
+// ?level=warn|error 只推送该级别及以上的日志，?username= 只推送指定账号的日志，?tail=N 先推送最近N条(默认50)。
+// 没有设置 token 时只接受同源的升级请求
+func handleLogs(w http.ResponseWriter, r *http.Request, authenticated bool) {
+	minLevel := levelInfo
+	if name := r.URL.Query().Get("level"); name != "" {
+		level, ok := parseLevel(name)
+		if !ok {
+			http.Error(w, "unknown level: "+name, http.StatusBadRequest)
+			return
+		}
+		minLevel = level
+	}
+	username := r.URL.Query().Get("username")
+	tail := 50
+	if raw := r.URL.Query().Get("tail"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "invalid tail: "+raw, http.StatusBadRequest)
+			return
+		}
+		tail = n
+	}
+
+	conn, err := upgradeWebsocket(w, r, authenticated)
+	if err != nil {
+		return
+	}
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	events, backlog := logHub.Subscribe(tail)
+	defer logHub.Unsubscribe(events)
+
+	ws := &websocketConn{conn: conn}
+	closed := make(chan struct{})
+	go func() {
+		ws.readLoop()
+		close(closed)
+	}()
+
+	send := func(event *LogEvent) error {
+		if event.level < minLevel || username != "" && event.Username != username {
+			return nil
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return nil
+		}
+		return ws.writeFrame(websocketText, data)
+	}
+
+	for _, event := range backlog {
+		if send(event) != nil {
+			return
+		}
+	}
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case event := <-events:
+			err = send(event)
+		case <-ping.C:
+			err = ws.writeFrame(websocketPing, nil)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func parseLevel(name string) (int, bool) {
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, true
+		}
+	}
+	return 0, false
+}
+
+const (
+	websocketText  = 0x1
+	websocketClose = 0x8
+	websocketPing  = 0x9
+	websocketPong  = 0xa
+
+	// websocketMaxFrame 是接受的客户端帧上限，客户端只会发送控制帧
+	websocketMaxFrame = 4096
+)
+
+// upgradeWebsocket 完成 RFC 6455 握手并接管连接，失败时已经写好了错误响应。
+// WebSocket 不受同源策略限制，任何网页都能连到本机的接口读取日志，
+// 因此 allowCrossOrigin 为 false(没有设置 token)时拒绝 Origin 与请求的主机不同的升级
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request, allowCrossOrigin bool) (net.Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !isWebsocketUpgrade(r) || key == "" {
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return nil, errors.New("not a websocket request")
+	}
+	if !allowCrossOrigin && !isSameOrigin(r) {
+		http.Error(w, "cross-origin websocket requires -api-token", http.StatusForbidden)
+		return nil, errors.New("cross-origin websocket request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusBadRequest)
+		return nil, errors.New("unsupported websocket version")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("connection cannot be hijacked")
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	if _, err = buf.WriteString(response); err == nil {
+		err = buf.Flush()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &bufferedConn{Conn: conn, reader: buf.Reader}, nil
+}
+
+func isWebsocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// isSameOrigin 判断浏览器发来的 Origin 是否与请求的主机相同，非浏览器客户端不带 Origin，视为同源
+func isSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	return strings.EqualFold(parsed.Host, r.Host)
+}
+
+// bufferedConn 保留握手时 bufio.Reader 中已经读入的数据
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+type websocketConn struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+}
+
+// writeFrame 写一个不分片的帧，服务端发出的帧不加掩码
+func (ws *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = binary.BigEndian.AppendUint16(append(frame, 126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, 127), uint64(n))
+	}
+
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	_ = ws.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := ws.conn.Write(append(frame, payload...))
+	return err
+}
+
+// readLoop 处理客户端发来的帧：回应ping，收到close或连接出错时返回，其余内容忽略
+func (ws *websocketConn) readLoop() {
+	header := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(ws.conn, header); err != nil {
+			return
+		}
+		opcode := header[0] & 0x0f
+		length := uint64(header[1] & 0x7f)
+		switch length {
+		case 126:
+			ext := make([]byte, 2)
+			if _, err := io.ReadFull(ws.conn, ext); err != nil {
+				return
+			}
+			length = uint64(binary.BigEndian.Uint16(ext))
+		case 127:
+			ext := make([]byte, 8)
+			if _, err := io.ReadFull(ws.conn, ext); err != nil {
+				return
+			}
+			length = binary.BigEndian.Uint64(ext)
+		}
+		if length > websocketMaxFrame {
+			return
+		}
+
+		var mask []byte
+		if header[1]&0x80 != 0 {
+			mask = make([]byte, 4)
+			if _, err := io.ReadFull(ws.conn, mask); err != nil {
+				return
+			}
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(ws.conn, payload); err != nil {
+			return
+		}
+		for i := range payload {
+			if mask != nil {
+				payload[i] ^= mask[i%4]
+			}
+		}
+
+		switch opcode {
+		case websocketClose:
+			_ = ws.writeFrame(websocketClose, payload[:min(len(payload), 2)])
+			return
+		case websocketPing:
+			if ws.writeFrame(websocketPong, payload) != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsSameOrigin(t *testing.T) {
+	tests := []struct {
+		origin, host string
+		want         bool
+	}{
+		{"", "192.168.1.1:8080", true},
+		{"http://192.168.1.1:8080", "192.168.1.1:8080", true},
+		{"http://Router.Lan:8080", "router.lan:8080", true},
+		{"https://evil.example", "192.168.1.1:8080", false},
+		{"http://192.168.1.1:9090", "192.168.1.1:8080", false},
+		{"null", "192.168.1.1:8080", false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://"+test.host+"/logs", nil)
+		r.Header.Set("Origin", test.origin)
+		if got := isSameOrigin(r); got != test.want {
+			t.Errorf("isSameOrigin(Origin %q, Host %q) = %v, want %v", test.origin, test.host, got, test.want)
+		}
+	}
+}
+
+func TestUpgradeWebsocketRejectsCrossOrigin(t *testing.T) {
+	for _, authenticated := range []bool{false, true} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handleLogs(w, r, authenticated)
+		}))
+
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/logs?tail=0", nil)
+		request.Header.Set("Connection", "Upgrade")
+		request.Header.Set("Upgrade", "websocket")
+		request.Header.Set("Sec-WebSocket-Version", "13")
+		request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		request.Header.Set("Origin", "https://evil.example")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = response.Body.Close()
+		server.Close()
+
+		want := http.StatusForbidden
+		if authenticated {
+			want = http.StatusSwitchingProtocols
+		}
+		if response.StatusCode != want {
+			t.Errorf("authenticated=%v: status %d, want %d", authenticated, response.StatusCode, want)
+		}
+	}
+}
+
+// readServerFrame 解析服务端发出的不加掩码的帧
+func readServerFrame(t *testing.T, r io.Reader) (byte, []byte) {
+	t.Helper()
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		t.Fatal(err)
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		t.Fatalf("frame header %x: want FIN set and no mask", header)
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		_, _ = io.ReadFull(r, ext)
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		_, _ = io.ReadFull(r, ext)
+		length = binary.BigEndian.Uint64(ext)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+// clientFrame 按客户端的要求生成加掩码的帧
+func clientFrame(opcode byte, payload []byte) []byte {
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+func TestWebsocketWriteFrameLengths(t *testing.T) {
+	for _, n := range []int{0, 125, 126, 0xffff, 0x10000} {
+		server, client := net.Pipe()
+		ws := &websocketConn{conn: server}
+		payload := bytes.Repeat([]byte{'x'}, n)
+		go func() {
+			_ = ws.writeFrame(websocketText, payload)
+		}()
+
+		_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		opcode, got := readServerFrame(t, client)
+		if opcode != websocketText || !bytes.Equal(got, payload) {
+			t.Errorf("length %d: got opcode %x and %d bytes", n, opcode, len(got))
+		}
+		_ = server.Close()
+		_ = client.Close()
+	}
+}
+
+func TestWebsocketReadLoop(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	ws := &websocketConn{conn: server}
+	done := make(chan struct{})
+	go func() {
+		ws.readLoop()
+		close(done)
+	}()
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// 文本帧被忽略，ping 以相同内容的 pong 回应
+	go func() {
+		_, _ = client.Write(append(clientFrame(websocketText, []byte("ignored")), clientFrame(websocketPing, []byte("hi"))...))
+	}()
+	if opcode, payload := readServerFrame(t, client); opcode != websocketPong || string(payload) != "hi" {
+		t.Fatalf("reply to ping: opcode %x payload %q", opcode, payload)
+	}
+
+	go func() {
+		_, _ = client.Write(clientFrame(websocketClose, []byte{0x03, 0xe8, 'b', 'y', 'e'}))
+	}()
+	if opcode, payload := readServerFrame(t, client); opcode != websocketClose || !bytes.Equal(payload, []byte{0x03, 0xe8}) {
+		t.Fatalf("reply to close: opcode %x payload %x", opcode, payload)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("readLoop did not return after close")
+	}
+}
+
+func TestWebsocketReadLoopRejectsLargeFrames(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	ws := &websocketConn{conn: server}
+	done := make(chan struct{})
+	go func() {
+		ws.readLoop()
+		close(done)
+	}()
+
+	header := binary.BigEndian.AppendUint64([]byte{0x80 | websocketText, 0x80 | 127}, websocketMaxFrame+1)
+	go func() {
+		_, _ = client.Write(header)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("readLoop accepted a frame larger than websocketMaxFrame")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/md5"
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// MacvlanConfig 描述多拨时自动创建的macvlan子接口
+type MacvlanConfig struct {
+	Parent      string `json:"parent"`
+	Name        string `json:"name"`
+	MAC         string `json:"mac"`
+	DhcpCommand string `json:"dhcp_command"`
+	DhcpTimeout int    `json:"dhcp_timeout"`
+}
+
+// macvlanMAC 未指定MAC时根据账号和接口名生成固定的本地管理地址，重启后DHCP仍能拿到相同的租约
+func macvlanMAC(c *Config) string {
+	if c.Macvlan.MAC != "" {
+		return c.Macvlan.MAC
+	}
+	sum := md5.Sum([]byte(c.Username + "/" + c.Macvlan.Name))
+	mac := net.HardwareAddr(sum[:6])
+	mac[0] = (mac[0] & 0xfe) | 0x02
+	return mac.String()
+}
+
+// macvlanNamePattern 限制自动创建的接口名：不超过Linux的15个字符，且不能被 ip 当作选项或关键字
+var macvlanNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,14}$`)
+
+func (m *MacvlanConfig) validate() error {
+	if m.Parent == "" || m.Name == "" {
+		return errors.New("macvlan requires parent and name")
+	}
+	if !macvlanNamePattern.MatchString(m.Name) {
+		return errors.New("invalid macvlan name: " + m.Name)
+	}
+	if !macvlanNamePattern.MatchString(m.Parent) {
+		return errors.New("invalid macvlan parent: " + m.Parent)
+	}
+	if m.Name == m.Parent {
+		return errors.New("macvlan name is the same as its parent: " + m.Name)
+	}
+	if m.MAC != "" {
+		mac, err := net.ParseMAC(m.MAC)
+		if err != nil || len(mac) != 6 || mac[0]&0x01 != 0 {
+			return errors.New("invalid macvlan mac: " + m.MAC)
+		}
+	}
+	return nil
+}
+
+// isMacvlanOn 根据 `ip -d link show dev <name>` 的输出判断该接口是否为 parent 上的macvlan，
+// 只有这样的接口才可以在创建前删除，避免配置写错时删掉真实的网卡
+func isMacvlanOn(output string, name string, parent string) bool {
+	lines := strings.Split(output, "\n")
+	if !strings.Contains(lines[0], " "+name+"@"+parent+":") {
+		return false
+	}
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(strings.TrimSpace(line), "macvlan ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+type macvlanLink struct {
+	Name    string
+	PidFile string
+	DHCP    *exec.Cmd
+}
+
+var macvlanLinks []*macvlanLink
+
+// SetupMacvlans 为配置了 macvlan 的账号创建子接口并通过DHCP获取地址，
+// 之后该账号绑定到新建的子接口上
+func SetupMacvlans(configs []*Config) error {
+	for _, c := range configs {
+		if c.Macvlan == nil {
+			continue
+		}
+		if err := c.Macvlan.validate(); err != nil {
+			return fmt.Errorf("%s: %v", c.Username, err)
+		}
+
+		link, err := createMacvlan(c)
+		if err != nil {
+			TeardownMacvlans()
+			return fmt.Errorf("%s: %v", c.Username, err)
+		}
+		macvlanLinks = append(macvlanLinks, link)
+		c.BindInterface = c.Macvlan.Name
+	}
+	return nil
+}
+
+func createMacvlan(c *Config) (*macvlanLink, error) {
+	m := c.Macvlan
+	mac := macvlanMAC(c)
+
+	// 上次异常退出留下的同名子接口先删除；同名的接口不是该父网卡上的macvlan时拒绝继续
+	if out, err := exec.Command("ip", "-d", "link", "show", "dev", m.Name).CombinedOutput(); err == nil {
+		if !isMacvlanOn(string(out), m.Name, m.Parent) {
+			return nil, fmt.Errorf("interface %s already exists and is not a macvlan on %s", m.Name, m.Parent)
+		}
+		if out, err = exec.Command("ip", "link", "del", "dev", m.Name).CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("remove stale macvlan %s: %v %s", m.Name, err, strings.TrimSpace(string(out)))
+		}
+	}
+	if out, err := exec.Command("ip", "link", "add", "link", m.Parent, "name", m.Name,
+		"address", mac, "type", "macvlan", "mode", "bridge").CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("create macvlan %s: %v %s", m.Name, err, strings.TrimSpace(string(out)))
+	}
+	link := &macvlanLink{Name: m.Name}
+
+	if out, err := exec.Command("ip", "link", "set", m.Name, "up").CombinedOutput(); err != nil {
+		link.teardown()
+		return nil, fmt.Errorf("set %s up: %v %s", m.Name, err, strings.TrimSpace(string(out)))
+	}
+	log.Printf(T("macvlan %s created on %s with mac %s"), m.Name, m.Parent, mac)
+
+	if err := link.startDHCP(m); err != nil {
+		link.teardown()
+		return nil, err
+	}
+	return link, nil
+}
+
+// startDHCP 在子接口上运行DHCP客户端并等待拿到地址，默认依次尝试 udhcpc 和 dhclient
+func (l *macvlanLink) startDHCP(m *MacvlanConfig) error {
+	var args []string
+	switch {
+	case m.DhcpCommand != "":
+		args = strings.Fields(strings.ReplaceAll(m.DhcpCommand, "{interface}", l.Name))
+	case lookPath("udhcpc"):
+		l.PidFile = "/var/run/udhcpc-" + l.Name + ".pid"
+		args = []string{"udhcpc", "-f", "-i", l.Name, "-p", l.PidFile}
+	case lookPath("dhclient"):
+		l.PidFile = "/var/run/dhclient-" + l.Name + ".pid"
+		args = []string{"dhclient", "-d", "-pf", l.PidFile, l.Name}
+	default:
+		return errors.New("no dhcp client found, install udhcpc or dhclient or set dhcp_command")
+	}
+
+	l.DHCP = exec.Command(args[0], args[1:]...)
+	if err := l.DHCP.Start(); err != nil {
+		return fmt.Errorf("start dhcp on %s: %v", l.Name, err)
+	}
+
+	timeout := time.Millisecond * time.Duration(m.DhcpTimeout)
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(500 * time.Millisecond) {
+		if ip, err := GetInterfaceIP(l.Name); err == nil {
+			log.Printf(T("macvlan %s got address %s"), l.Name, ip)
+			return nil
+		}
+	}
+	return fmt.Errorf("dhcp on %s timed out after %v", l.Name, timeout)
+}
+
+func (l *macvlanLink) teardown() {
+	if l.DHCP != nil && l.DHCP.Process != nil {
+		_ = l.DHCP.Process.Kill()
+		_ = l.DHCP.Wait()
+	}
+	if l.PidFile != "" {
+		_ = os.Remove(l.PidFile)
+	}
+	if out, err := exec.Command("ip", "link", "del", l.Name).CombinedOutput(); err != nil {
+		log.Printf(T("remove macvlan %s failed: %v %s"), l.Name, err, strings.TrimSpace(string(out)))
+		return
+	}
+	log.Printf(T("macvlan %s removed"), l.Name)
+}
+
+// TeardownMacvlans 停止DHCP并删除自动创建的子接口
+func TeardownMacvlans() {
+	for _, link := range macvlanLinks {
+		link.teardown()
+	}
+	macvlanLinks = nil
+}
+
+func lookPath(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
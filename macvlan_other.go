@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+func SetupMacvlans(configs []*Config) error {
+	for _, c := range configs {
+		if c.Macvlan != nil {
+			return errors.New("macvlan is only supported on linux")
+		}
+	}
+	return nil
+}
+
+func TeardownMacvlans() {}
@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestMacvlanValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config MacvlanConfig
+		ok     bool
+	}{
+		{"ok", MacvlanConfig{Parent: "eth0", Name: "macvlan1"}, true},
+		{"ok with mac", MacvlanConfig{Parent: "eth0", Name: "macvlan1", MAC: "02:11:22:33:44:55"}, true},
+		{"missing name", MacvlanConfig{Parent: "eth0"}, false},
+		{"same as parent", MacvlanConfig{Parent: "eth0", Name: "eth0"}, false},
+		{"option-like name", MacvlanConfig{Parent: "eth0", Name: "-force"}, false},
+		{"keyword in name", MacvlanConfig{Parent: "eth0", Name: "macvlan1 type"}, false},
+		{"name too long", MacvlanConfig{Parent: "eth0", Name: "macvlan12345678901"}, false},
+		{"bad mac", MacvlanConfig{Parent: "eth0", Name: "macvlan1", MAC: "02:11:22"}, false},
+		{"multicast mac", MacvlanConfig{Parent: "eth0", Name: "macvlan1", MAC: "01:00:5e:00:00:01"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err == nil) != tt.ok {
+				t.Fatalf("validate() = %v, want ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestIsMacvlanOn(t *testing.T) {
+	macvlan := `7: macvlan1@eth0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc noqueue state UP mode DEFAULT group default qlen 1000
+    link/ether 02:11:22:33:44:55 brd ff:ff:ff:ff:ff:ff promiscuity 0 minmtu 68 maxmtu 1500
+    macvlan mode bridge bcqueuelen 1000 usedbcqueuelen 1000 numtxqueues 1 numrxqueues 1
+`
+	physical := `2: eth0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc fq_codel state UP mode DEFAULT group default qlen 1000
+    link/ether 52:54:00:12:34:56 brd ff:ff:ff:ff:ff:ff promiscuity 0 minmtu 68 maxmtu 65535
+`
+	vlan := `8: macvlan1@eth0: <BROADCAST,MULTICAST> mtu 1500 qdisc noop state DOWN mode DEFAULT group default qlen 1000
+    link/ether 52:54:00:12:34:56 brd ff:ff:ff:ff:ff:ff promiscuity 0 minmtu 0 maxmtu 65535
+    vlan protocol 802.1Q id 100 <REORDER_HDR>
+`
+
+	if !isMacvlanOn(macvlan, "macvlan1", "eth0") {
+		t.Error("macvlan on eth0 not recognized")
+	}
+	if isMacvlanOn(macvlan, "macvlan1", "eth1") {
+		t.Error("macvlan on eth0 accepted for parent eth1")
+	}
+	if isMacvlanOn(physical, "eth0", "eth1") {
+		t.Error("physical interface accepted as macvlan")
+	}
+	if isMacvlanOn(vlan, "macvlan1", "eth0") {
+		t.Error("vlan interface accepted as macvlan")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrMaintenance 表示门户正在维护或只返回了公告页面
+var ErrMaintenance = errors.New("portal under maintenance")
+
+var maintenanceKeywords = []string{"系统维护", "维护中", "正在维护", "升级维护", "停机维护", "暂停服务", "maintenance"}
+
+var htmlTitlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// MaintenanceError 是门户返回维护/公告页面时的错误
+type MaintenanceError struct {
+	Message string
+}
+
+func (e *MaintenanceError) Error() string {
+	return T("portal under maintenance:") + " " + e.Message
+}
+
+func (e *MaintenanceError) Is(target error) bool {
+	return target == ErrMaintenance
+}
+
+// DetectMaintenance 判断门户返回的HTML是否为维护公告，是则返回 MaintenanceError
+func DetectMaintenance(body []byte) error {
+	if !bytes.Contains(bytes.ToLower(body), []byte("<html")) || !containsAny(string(body), maintenanceKeywords) {
+		return nil
+	}
+
+	message := "announcement page"
+	if m := htmlTitlePattern.FindSubmatch(body); m != nil && len(bytes.TrimSpace(m[1])) > 0 {
+		message = strings.TrimSpace(string(m[1]))
+	}
+	return &MaintenanceError{Message: message}
+}
+
+// enterMaintenance 门户维护期间按 maintenance_interval 暂停检测，避免在停机时段不停请求网关
+func (c *Client) enterMaintenance(err error) {
+	interval := time.Millisecond * time.Duration(c.Config.MaintenanceInterval)
+	c.Log.Printf(T("portal under maintenance, next attempt in %v: %v"), interval, err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.MaintenanceUntil = time.Now().Add(interval)
+}
+
+func (c *Client) inMaintenance() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Now().Before(c.status.MaintenanceUntil)
+}
+
+func (c *Client) clearMaintenance() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.MaintenanceUntil = time.Time{}
+}
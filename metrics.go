@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Histogram 是按 Prometheus 累积桶语义统计的直方图
+type Histogram struct {
+	Buckets []float64
+	Counts  []uint64
+	Sum     float64
+	Count   uint64
+}
+
+func NewHistogram(buckets []float64) *Histogram {
+	return &Histogram{Buckets: buckets, Counts: make([]uint64, len(buckets))}
+}
+
+func (h *Histogram) Observe(v float64) {
+	for i, bound := range h.Buckets {
+		if v <= bound {
+			h.Counts[i]++
+		}
+	}
+	h.Sum += v
+	h.Count++
+}
+
+func (h *Histogram) Copy() *Histogram {
+	c := *h
+	c.Counts = append([]uint64(nil), h.Counts...)
+	return &c
+}
+
+func (c *Client) observeAuthLatency(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.authLatency.Observe(d.Seconds())
+}
+
+func (c *Client) observeHeartbeatRTT(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.heartbeatRTT.Observe(d.Seconds())
+}
+
+func (c *Client) histograms() (authLatency *Histogram, heartbeatRTT *Histogram) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.authLatency.Copy(), c.heartbeatRTT.Copy()
+}
+
+// WriteMetrics 以 Prometheus 文本格式输出所有账号的指标，按用户名和网卡打标签
+func WriteMetrics(w io.Writer) {
+	selected := SelectClients("")
+
+	writeHeader(w, "esurfing_online", "gauge", "Whether the account is currently authenticated.")
+	for _, c := range selected {
+		s := c.Status()
+		fmt.Fprintf(w, "esurfing_online{%s} %d\n", metricLabels(s), boolToInt(s.Online))
+	}
+
+	writeHeader(w, "esurfing_auth_total", "counter", "Authentication attempts by result.")
+	for _, c := range selected {
+		s := c.Status()
+		fmt.Fprintf(w, "esurfing_auth_total{%s,result=\"success\"} %d\n", metricLabels(s), s.AuthCount)
+		fmt.Fprintf(w, "esurfing_auth_total{%s,result=\"failure\"} %d\n", metricLabels(s), s.AuthFailures)
+	}
+
+	writeHeader(w, "esurfing_heartbeat_total", "counter", "Heartbeats by result.")
+	for _, c := range selected {
+		s := c.Status()
+		fmt.Fprintf(w, "esurfing_heartbeat_total{%s,result=\"success\"} %d\n", metricLabels(s), s.HeartbeatCount)
+		fmt.Fprintf(w, "esurfing_heartbeat_total{%s,result=\"failure\"} %d\n", metricLabels(s), s.HeartbeatFailures)
+	}
+
+	writeHeader(w, "esurfing_last_auth_timestamp_seconds", "gauge", "Unix time of the last successful authentication.")
+	for _, c := range selected {
+		s := c.Status()
+		var ts int64
+		if !s.AuthTime.IsZero() {
+			ts = s.AuthTime.Unix()
+		}
+		fmt.Fprintf(w, "esurfing_last_auth_timestamp_seconds{%s} %d\n", metricLabels(s), ts)
+	}
+
+	writeHeader(w, "esurfing_session_receive_bytes", "gauge", "Bytes received on the interface since the current session was authenticated.")
+	for _, c := range selected {
+		s := c.Status()
+		fmt.Fprintf(w, "esurfing_session_receive_bytes{%s} %d\n", metricLabels(s), s.SessionRxBytes)
+	}
+
+	writeHeader(w, "esurfing_session_transmit_bytes", "gauge", "Bytes sent on the interface since the current session was authenticated.")
+	for _, c := range selected {
+		s := c.Status()
+		fmt.Fprintf(w, "esurfing_session_transmit_bytes{%s} %d\n", metricLabels(s), s.SessionTxBytes)
+	}
+
+	writeHeader(w, "esurfing_auth_duration_seconds", "histogram", "Duration of the full authentication flow.")
+	for _, c := range selected {
+		authLatency, _ := c.histograms()
+		writeHistogram(w, "esurfing_auth_duration_seconds", metricLabels(c.Status()), authLatency)
+	}
+
+	writeHeader(w, "esurfing_heartbeat_rtt_seconds", "histogram", "Round trip time of heartbeat requests.")
+	for _, c := range selected {
+		_, heartbeatRTT := c.histograms()
+		writeHistogram(w, "esurfing_heartbeat_rtt_seconds", metricLabels(c.Status()), heartbeatRTT)
+	}
+}
+
+func writeHeader(w io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeHistogram(w io.Writer, name string, labels string, h *Histogram) {
+	for i, bound := range h.Buckets {
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, strconv.FormatFloat(bound, 'g', -1, 64), h.Counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.Count)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(h.Sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.Count)
+}
+
+func metricLabels(s ClientStatus) string {
+	return fmt.Sprintf("username=\"%s\",interface=\"%s\"", escapeLabel(s.Username), escapeLabel(s.Interface))
+}
+
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 这里只实现了发布状态所需的最小 MQTT 3.1.1 客户端：QoS 0 的发布和订阅、遗嘱消息和心跳
+
+const (
+	mqttConnect    = 0x10
+	mqttConnAck    = 0x20
+	mqttPublish    = 0x30
+	mqttSubscribe  = 0x82
+	mqttPingReq    = 0xc0
+	mqttPingResp   = 0xd0
+	mqttDisconnect = 0xe0
+
+	mqttKeepAlive = 60 * time.Second
+	// mqttMaxPacket 是接受的单个报文上限，这里只会收到按钮命令
+	mqttMaxPacket = 64 * 1024
+
+	mqttPayloadOnline  = "online"
+	mqttPayloadOffline = "offline"
+)
+
+// MQTTPublisher 定时把每个账号的状态发布到MQTT。DiscoveryPrefix 不为空时同时发布 Home Assistant 的自动发现配置，
+// 在线状态、会话时长和重新认证按钮会自动出现在 Home Assistant 中，不需要手写YAML
+type MQTTPublisher struct {
+	URL             *url.URL
+	Topic           string
+	DiscoveryPrefix string
+	Interval        time.Duration
+
+	clientID   string
+	keepAlive  time.Duration
+	discovered map[string]bool
+	conn       net.Conn
+	writeMu    sync.Mutex
+	// pingPending 在发出 PINGREQ 后置位，收到 PINGRESP 时清除
+	pingPending atomic.Bool
+	done        chan struct{}
+	stopped     chan struct{}
+}
+
+// mqttState 是发布到 <topic>/<账号>/state 的状态
+type mqttState struct {
+	Online    bool   `json:"online"`
+	Uptime    int64  `json:"uptime"`
+	UserIP    string `json:"user_ip"`
+	Interface string `json:"interface"`
+	LastError string `json:"last_error"`
+}
+
+var mqttObjectIDPattern = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// StartMQTT 校验参数并在后台连接broker，断线后自动重连，返回的 MQTTPublisher 用于停止
+func StartMQTT(rawURL string, topic string, discoveryPrefix string, interval time.Duration) (*MQTTPublisher, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mqtt url %q: %v", rawURL, err)
+	}
+	if parsed.Scheme != "mqtt" && parsed.Scheme != "mqtts" {
+		return nil, fmt.Errorf("mqtt url %q must use mqtt or mqtts", parsed.Redacted())
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("mqtt url %q has no host", parsed.Redacted())
+	}
+	if topic == "" || strings.ContainsAny(topic, "+#") {
+		return nil, errors.New("invalid mqtt topic: " + topic)
+	}
+	if interval <= 0 {
+		return nil, errors.New("mqtt interval must be positive")
+	}
+
+	m := &MQTTPublisher{
+		URL:             parsed,
+		Topic:           strings.TrimSuffix(topic, "/"),
+		DiscoveryPrefix: strings.TrimSuffix(discoveryPrefix, "/"),
+		Interval:        interval,
+		clientID:        "esurfing-go-" + GenerateRandomString(8),
+		keepAlive:       mqttKeepAlive,
+		done:            make(chan struct{}),
+		stopped:         make(chan struct{}),
+	}
+	go m.run()
+	return m, nil
+}
+
+// String 返回隐藏了密码的broker地址，用于日志
+func (m *MQTTPublisher) String() string {
+	return m.URL.Redacted()
+}
+
+// Stop 发布离线状态并断开连接
+func (m *MQTTPublisher) Stop() {
+	close(m.done)
+	<-m.stopped
+}
+
+func (m *MQTTPublisher) run() {
+	defer close(m.stopped)
+
+	backoff := 5 * time.Second
+	for {
+		connected, err := m.session()
+		if err == nil {
+			return
+		}
+		if connected {
+			backoff = 5 * time.Second
+		}
+		log.Printf(T("mqtt error: %v, reconnecting in %v"), err, backoff)
+
+		select {
+		case <-m.done:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 5*time.Minute)
+	}
+}
+
+// session 维持一次连接，直到出错或 Stop。返回的 connected 表示是否曾经连接成功
+func (m *MQTTPublisher) session() (connected bool, err error) {
+	conn, err := m.dial()
+	if err != nil {
+		return false, err
+	}
+	m.conn = conn
+	m.discovered = map[string]bool{}
+	m.pingPending.Store(false)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	if err = m.connect(reader); err != nil {
+		return false, err
+	}
+	if err = m.write(mqttSubscribePacket(1, m.Topic+"/+/command")); err != nil {
+		return true, err
+	}
+	if err = m.publish(m.availabilityTopic(), []byte(mqttPayloadOnline), true); err != nil {
+		return true, err
+	}
+	log.Println(T("mqtt connected:"), m)
+
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- m.readLoop(reader)
+	}()
+
+	publishTicker := time.NewTicker(m.Interval)
+	defer publishTicker.Stop()
+	pingTicker := time.NewTicker(m.keepAlive / 2)
+	defer pingTicker.Stop()
+
+	if err = m.publishStates(); err != nil {
+		return true, err
+	}
+	for {
+		select {
+		case <-m.done:
+			_ = m.publish(m.availabilityTopic(), []byte(mqttPayloadOffline), true)
+			_ = m.write([]byte{mqttDisconnect, 0})
+			return true, nil
+		case err = <-readErr:
+			return true, err
+		case <-pingTicker.C:
+			// 上一次 PINGREQ 过了半个心跳周期还没有回应，连接多半已经断了(如NAT表项过期)，重连而不是一直写入
+			if m.pingPending.Swap(true) {
+				return true, errors.New("mqtt: broker did not answer ping")
+			}
+			err = m.write([]byte{mqttPingReq, 0})
+		case <-publishTicker.C:
+			err = m.publishStates()
+		}
+		if err != nil {
+			return true, err
+		}
+	}
+}
+
+func (m *MQTTPublisher) dial() (net.Conn, error) {
+	host := m.URL.Host
+	if m.URL.Port() == "" {
+		port := "1883"
+		if m.URL.Scheme == "mqtts" {
+			port = "8883"
+		}
+		host = net.JoinHostPort(m.URL.Hostname(), port)
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if m.URL.Scheme == "mqtts" {
+		return tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: m.URL.Hostname()})
+	}
+	return dialer.Dial("tcp", host)
+}
+
+// connect 发送 CONNECT 并等待 CONNACK，遗嘱消息在异常断线时把可用性置为 offline
+func (m *MQTTPublisher) connect(reader *bufio.Reader) error {
+	flags := byte(0x02 | 0x04 | 0x20) // clean session、遗嘱、遗嘱保留
+	payload := mqttString(nil, m.clientID)
+	payload = mqttString(payload, m.availabilityTopic())
+	payload = mqttString(payload, mqttPayloadOffline)
+	if m.URL.User != nil {
+		flags |= 0x80
+		payload = mqttString(payload, m.URL.User.Username())
+		if password, ok := m.URL.User.Password(); ok {
+			flags |= 0x40
+			payload = mqttString(payload, password)
+		}
+	}
+
+	header := mqttString(nil, "MQTT")
+	header = append(header, 4, flags)
+	header = binary.BigEndian.AppendUint16(header, uint16(m.keepAlive/time.Second))
+
+	_ = m.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer func() {
+		_ = m.conn.SetDeadline(time.Time{})
+	}()
+	if err := m.write(mqttPacket(mqttConnect, append(header, payload...))); err != nil {
+		return err
+	}
+
+	kind, body, err := mqttRead(reader)
+	if err != nil {
+		return err
+	}
+	if kind != mqttConnAck || len(body) < 2 {
+		return fmt.Errorf("unexpected mqtt packet 0x%02x", kind)
+	}
+	if body[1] != 0 {
+		return fmt.Errorf("mqtt connection refused, code %d", body[1])
+	}
+	return nil
+}
+
+// readLoop 处理broker发来的报文，只关心 PINGRESP 和按钮命令。每半个心跳周期都会收到一次 PINGRESP，
+// 1.5 个心跳周期内什么都没有收到时认为连接已断开
+func (m *MQTTPublisher) readLoop(reader *bufio.Reader) error {
+	timeout := m.keepAlive * 3 / 2
+	for {
+		_ = m.conn.SetReadDeadline(time.Now().Add(timeout))
+		kind, body, err := mqttRead(reader)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return fmt.Errorf("mqtt: nothing received from broker in %v", timeout)
+		}
+		if err != nil {
+			return err
+		}
+		if kind == mqttPingResp {
+			m.pingPending.Store(false)
+			continue
+		}
+		if kind&0xf0 != mqttPublish {
+			continue
+		}
+		topic, payload, ok := mqttParsePublish(kind, body)
+		if ok {
+			m.handleCommand(topic, string(payload))
+		}
+	}
+}
+
+// handleCommand 执行 <topic>/<账号>/command 上收到的命令，目前只有重新认证
+func (m *MQTTPublisher) handleCommand(topic string, payload string) {
+	rest, ok := strings.CutPrefix(topic, m.Topic+"/")
+	if !ok {
+		return
+	}
+	objectID, _, _ := strings.Cut(rest, "/")
+	if strings.TrimSpace(payload) != CommandRelogin {
+		return
+	}
+	for _, c := range SelectClients("") {
+		if mqttObjectID(c) == objectID {
+			log.Printf(T("mqtt relogin requested for %s"), c.Config.Username)
+			c.Send(CommandRelogin)
+		}
+	}
+}
+
+// publishStates 发布所有账号的状态，新出现的账号(如重新加载配置后)先发布自动发现配置
+func (m *MQTTPublisher) publishStates() error {
+	for _, c := range SelectClients("") {
+		objectID := mqttObjectID(c)
+		if m.DiscoveryPrefix != "" && !m.discovered[objectID] {
+			if err := m.publishDiscovery(c, objectID); err != nil {
+				return err
+			}
+			m.discovered[objectID] = true
+		}
+
+		s := c.Status()
+		state := mqttState{Online: s.Online, UserIP: s.UserIP, Interface: s.Interface, LastError: s.LastError}
+		if s.Online && !s.AuthTime.IsZero() {
+			state.Uptime = int64(time.Since(s.AuthTime).Seconds())
+		}
+		data, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		if err = m.publish(m.Topic+"/"+objectID+"/state", data, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishDiscovery 发布一个账号的 Home Assistant 实体：在线状态、会话时长和重新认证按钮，同属一个设备
+func (m *MQTTPublisher) publishDiscovery(c *Client, objectID string) error {
+	uniqueID := "esurfing_" + objectID
+	stateTopic := m.Topic + "/" + objectID + "/state"
+	device := map[string]any{
+		"identifiers":  []string{uniqueID},
+		"name":         "Esurfing " + c.Config.Username,
+		"manufacturer": "Esurfing-go",
+	}
+
+	entities := []struct {
+		component string
+		config    map[string]any
+	}{
+		{"binary_sensor", map[string]any{
+			"name":           "Online",
+			"device_class":   "connectivity",
+			"state_topic":    stateTopic,
+			"value_template": "{{ 'ON' if value_json.online else 'OFF' }}",
+		}},
+		{"sensor", map[string]any{
+			"name":                "Session uptime",
+			"device_class":        "duration",
+			"unit_of_measurement": "s",
+			"state_topic":         stateTopic,
+			"value_template":      "{{ value_json.uptime }}",
+		}},
+		{"button", map[string]any{
+			"name":          "Relogin",
+			"command_topic": m.Topic + "/" + objectID + "/command",
+			"payload_press": CommandRelogin,
+		}},
+	}
+
+	for _, entity := range entities {
+		key := strings.ToLower(strings.ReplaceAll(entity.config["name"].(string), " ", "_"))
+		entity.config["unique_id"] = uniqueID + "_" + key
+		entity.config["availability_topic"] = m.availabilityTopic()
+		entity.config["device"] = device
+
+		data, err := json.Marshal(entity.config)
+		if err != nil {
+			return err
+		}
+		topic := m.DiscoveryPrefix + "/" + entity.component + "/" + uniqueID + "/" + key + "/config"
+		if err = m.publish(topic, data, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MQTTPublisher) availabilityTopic() string {
+	return m.Topic + "/status"
+}
+
+func (m *MQTTPublisher) publish(topic string, payload []byte, retain bool) error {
+	kind := byte(mqttPublish)
+	if retain {
+		kind |= 0x01
+	}
+	return m.write(mqttPacket(kind, append(mqttString(nil, topic), payload...)))
+}
+
+func (m *MQTTPublisher) write(packet []byte) error {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	_ = m.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := m.conn.Write(packet)
+	return err
+}
+
+// mqttObjectID 返回账号在主题和实体ID中使用的名称，绑定了网卡的账号附加网卡名以区分同一账号的多个实例
+func mqttObjectID(c *Client) string {
+	id := c.Config.Username
+	if c.Config.BindInterface != "" {
+		id += "_" + c.Config.BindInterface
+	}
+	return mqttObjectIDPattern.ReplaceAllString(id, "_")
+}
+
+func mqttSubscribePacket(packetID uint16, topic string) []byte {
+	body := binary.BigEndian.AppendUint16(nil, packetID)
+	body = append(mqttString(body, topic), 0)
+	return mqttPacket(mqttSubscribe, body)
+}
+
+func mqttPacket(kind byte, body []byte) []byte {
+	packet := []byte{kind}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+func mqttString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+// mqttRead 读取一个报文，返回首字节和剩余部分
+func mqttRead(reader *bufio.Reader) (byte, []byte, error) {
+	kind, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, shift := 0, 0
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, errors.New("mqtt: invalid remaining length")
+		}
+	}
+	if length > mqttMaxPacket {
+		return 0, nil, errors.New("mqtt: packet too large")
+	}
+
+	body := make([]byte, length)
+	if _, err = io.ReadFull(reader, body); err != nil {
+		return 0, nil, err
+	}
+	return kind, body, nil
+}
+
+// mqttParsePublish 解析 PUBLISH 报文的主题和内容，QoS>0 时跳过报文ID
+func mqttParsePublish(kind byte, body []byte) (string, []byte, bool) {
+	if len(body) < 2 {
+		return "", nil, false
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return "", nil, false
+	}
+	topic, rest := string(body[2:2+n]), body[2+n:]
+	if (kind>>1)&0x03 > 0 {
+		if len(rest) < 2 {
+			return "", nil, false
+		}
+		rest = rest[2:]
+	}
+	return topic, rest, true
+}
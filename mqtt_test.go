@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMQTTPacketRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, mqttMaxPacket} {
+		body := bytes.Repeat([]byte{'x'}, n)
+		packet := mqttPacket(mqttPublish|0x01, body)
+		kind, got, err := mqttRead(bufio.NewReader(bytes.NewReader(packet)))
+		if err != nil {
+			t.Fatalf("length %d: %v", n, err)
+		}
+		if kind != mqttPublish|0x01 || !bytes.Equal(got, body) {
+			t.Errorf("length %d: got kind 0x%02x and %d bytes", n, kind, len(got))
+		}
+	}
+}
+
+func TestMQTTPacketRemainingLength(t *testing.T) {
+	tests := []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+	}
+	for _, test := range tests {
+		packet := mqttPacket(mqttPingReq, make([]byte, test.n))
+		if got := packet[1 : 1+len(test.want)]; !bytes.Equal(got, test.want) {
+			t.Errorf("remaining length %d encoded as %x, want %x", test.n, got, test.want)
+		}
+	}
+}
+
+func TestMQTTReadRejectsBadPackets(t *testing.T) {
+	tests := map[string][]byte{
+		"remaining length over 4 bytes": {mqttPublish, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"too large":                     mqttPacket(mqttPublish, make([]byte, mqttMaxPacket+1)),
+		"truncated":                     {mqttPublish, 0x05, 'a'},
+	}
+	for name, data := range tests {
+		if _, _, err := mqttRead(bufio.NewReader(bytes.NewReader(data))); err == nil {
+			t.Errorf("%s: mqttRead succeeded", name)
+		}
+	}
+}
+
+func TestMQTTParsePublish(t *testing.T) {
+	body := append(mqttString(nil, "esurfing/alice/command"), []byte("relogin")...)
+	topic, payload, ok := mqttParsePublish(mqttPublish, body)
+	if !ok || topic != "esurfing/alice/command" || string(payload) != "relogin" {
+		t.Errorf("QoS 0: %q %q %v", topic, payload, ok)
+	}
+
+	// QoS 1 的主题后跟2字节的报文ID
+	withID := append(mqttString(nil, "t"), 0x00, 0x07, 'p')
+	if topic, payload, ok = mqttParsePublish(mqttPublish|0x02, withID); !ok || topic != "t" || string(payload) != "p" {
+		t.Errorf("QoS 1: %q %q %v", topic, payload, ok)
+	}
+
+	for _, bad := range [][]byte{nil, {0x00}, {0x00, 0x05, 't'}} {
+		if _, _, ok = mqttParsePublish(mqttPublish, bad); ok {
+			t.Errorf("mqttParsePublish(%x) succeeded", bad)
+		}
+	}
+}
+
+func TestMQTTSubscribePacket(t *testing.T) {
+	want := []byte{mqttSubscribe, 8, 0x00, 0x01, 0x00, 0x03, 'a', '/', 'b', 0x00}
+	if got := mqttSubscribePacket(1, "a/b"); !bytes.Equal(got, want) {
+		t.Errorf("mqttSubscribePacket = %x, want %x", got, want)
+	}
+}
+
+func TestMQTTReadLoopDetectsDeadConnection(t *testing.T) {
+	server, broker := net.Pipe()
+	defer broker.Close()
+	m := &MQTTPublisher{Topic: "esurfing", conn: server, keepAlive: 100 * time.Millisecond}
+	m.pingPending.Store(true)
+
+	result := make(chan error, 1)
+	go func() {
+		result <- m.readLoop(bufio.NewReader(server))
+	}()
+
+	if _, err := broker.Write([]byte{mqttPingResp, 0}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-result:
+		if err == nil || !strings.Contains(err.Error(), "nothing received") {
+			t.Fatalf("readLoop() = %v, want a dead connection error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("readLoop kept waiting on a silent broker")
+	}
+	if m.pingPending.Load() {
+		t.Error("PINGRESP did not clear the pending ping")
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+)
+
+// AssignInterfaces 为多拨的每个账号分配各自的网卡。多个账号使用相同的网段或
+// 通配符(如 macvlan*)时依次分配不同的网卡，两个账号落在同一网卡或源地址上时报错，
+// 否则它们会在同一个IP上互相顶替对方的会话
+func AssignInterfaces(configs []*Config) error {
+	claimed := map[string]string{}
+	boundIPs := map[string]string{}
+
+	for _, c := range configs {
+		if c.BindIP != "" {
+			if other, ok := boundIPs[c.BindIP]; ok {
+				return fmt.Errorf("bind ip %s is used by both %s and %s", c.BindIP, other, c.Username)
+			}
+			boundIPs[c.BindIP] = c.Username
+			continue
+		}
+		if c.BindInterface == "" {
+			continue
+		}
+
+		name, err := resolveInterface(c.BindInterface, claimed)
+		if err != nil {
+			return fmt.Errorf("%s: %v", c.Username, err)
+		}
+		if other, ok := claimed[name]; ok {
+			return fmt.Errorf("interface %s is used by both %s and %s", name, other, c.Username)
+		}
+		claimed[name] = c.Username
+		c.BindInterface = name
+	}
+	return nil
+}
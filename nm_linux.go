@@ -0,0 +1,187 @@
+//go:build linux
+
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	nmPath      = "/org/freedesktop/NetworkManager"
+	nmInterface = "org.freedesktop.NetworkManager"
+
+	// NM_STATE_CONNECTED_LOCAL 及以上表示已有可用的连接
+	nmStateConnectedLocal = 50
+	// NM_CONNECTIVITY_PORTAL 及以上表示已经连上网络(可能需要认证)
+	nmConnectivityPortal = 2
+
+	// nmDebounce 合并唤醒、切换网络时短时间内连续发出的多个信号
+	nmDebounce = 2 * time.Second
+
+	nmRetryMax = 5 * time.Minute
+)
+
+// nmRetryMin 是系统总线断开(如 dbus 重启)后第一次重连前的等待，之后逐次加倍到 nmRetryMax
+var nmRetryMin = 5 * time.Second
+
+// NMWatcher 通过系统总线监听 NetworkManager 的状态、连通性和活动连接的变化，
+// 网络恢复或切换后立即让所有账号重新检测，笔记本从睡眠中唤醒后几乎可以马上完成认证
+type NMWatcher struct {
+	done    chan struct{}
+	stopped chan struct{}
+
+	mu     sync.Mutex
+	bus    *dbusConn
+	timer  *time.Timer
+	reason string
+}
+
+func StartNMWatcher() (*NMWatcher, error) {
+	bus, err := connectNM()
+	if err != nil {
+		return nil, err
+	}
+	w := &NMWatcher{bus: bus, done: make(chan struct{}), stopped: make(chan struct{})}
+	go w.run()
+	return w, nil
+}
+
+// connectNM 连接系统总线并订阅 NetworkManager 的信号
+func connectNM() (*dbusConn, error) {
+	bus, err := dialSystemBus()
+	if err != nil {
+		return nil, err
+	}
+	rule := "type='signal',sender='" + nmInterface + "',path='" + nmPath + "'"
+	if _, err = bus.Call("/org/freedesktop/DBus", "org.freedesktop.DBus", "AddMatch", "org.freedesktop.DBus", rule); err != nil {
+		_ = bus.Close()
+		return nil, err
+	}
+	return bus, nil
+}
+
+// Stop 断开系统总线并等待后台的 goroutine 退出
+func (w *NMWatcher) Stop() {
+	w.mu.Lock()
+	close(w.done)
+	_ = w.bus.Close()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+	<-w.stopped
+}
+
+// run 处理信号直到 Stop。系统总线断开时记录错误并重连，重连后立即检测一次，断开期间可能错过了网络变化
+func (w *NMWatcher) run() {
+	defer close(w.stopped)
+	for {
+		err := w.watch()
+		backoff := nmRetryMin
+		for {
+			select {
+			case <-w.done:
+				return
+			default:
+			}
+			log.Printf(T("NetworkManager watcher error: %v, reconnecting in %v"), err, backoff)
+			select {
+			case <-w.done:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, nmRetryMax)
+
+			var bus *dbusConn
+			if bus, err = connectNM(); err == nil {
+				if !w.replaceBus(bus) {
+					return
+				}
+				break
+			}
+		}
+		w.schedule("reconnected to D-Bus")
+	}
+}
+
+// watch 读取当前连接上的信号，直到连接出错
+func (w *NMWatcher) watch() error {
+	w.mu.Lock()
+	bus := w.bus
+	w.mu.Unlock()
+
+	for {
+		msg, err := bus.Read()
+		if err != nil {
+			return err
+		}
+		if msg.Type != dbusSignal || msg.Path != nmPath {
+			continue
+		}
+		if reason := nmSignalReason(msg); reason != "" {
+			w.schedule(reason)
+		}
+	}
+}
+
+// replaceBus 换上重连后的连接，已经 Stop 时关闭它并返回 false
+func (w *NMWatcher) replaceBus(bus *dbusConn) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.done:
+		_ = bus.Close()
+		return false
+	default:
+	}
+	w.bus = bus
+	return true
+}
+
+// nmSignalReason 判断信号是否表示网络已连上或发生了切换，是则返回用于日志的说明
+func nmSignalReason(msg *dbusMessage) string {
+	switch {
+	case msg.Interface == nmInterface && msg.Member == "StateChanged" && len(msg.Body) == 1:
+		if state, ok := msg.Body[0].(uint32); ok && state >= nmStateConnectedLocal {
+			return "state connected"
+		}
+	case msg.Interface == "org.freedesktop.DBus.Properties" && msg.Member == "PropertiesChanged" && len(msg.Body) >= 2:
+		if iface, _ := msg.Body[0].(string); iface != nmInterface {
+			return ""
+		}
+		props, _ := msg.Body[1].(map[string]any)
+		if connectivity, ok := props["Connectivity"].(uint32); ok && connectivity >= nmConnectivityPortal {
+			return "connectivity changed"
+		}
+		if _, ok := props["ActiveConnections"]; ok {
+			return "active connections changed"
+		}
+	}
+	return ""
+}
+
+func (w *NMWatcher) schedule(reason string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+	w.reason = reason
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(nmDebounce, func() {
+		w.mu.Lock()
+		reason := w.reason
+		w.mu.Unlock()
+
+		log.Printf(T("NetworkManager: %s, checking now"), reason)
+		for _, c := range SelectClients("") {
+			c.Send(CommandCheck)
+		}
+	})
+}
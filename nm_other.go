@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+type NMWatcher struct{}
+
+func StartNMWatcher() (*NMWatcher, error) {
+	return nil, errors.New("NetworkManager integration is only supported on linux")
+}
+
+func (w *NMWatcher) Stop() {}
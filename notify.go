@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EventOnline          = "online"
+	EventOffline         = "offline"
+	EventAuthFailed      = "auth_failed"
+	EventHeartbeatSent   = "heartbeat_sent"
+	EventHeartbeatFailed = "heartbeat_failed"
+	EventLoggedOut       = "logged_out"
+	EventCircuitOpen     = "circuit_open"
+)
+
+// notifiableEvents 会发送给通知器的事件，心跳等频繁事件只发给订阅者
+var notifiableEvents = map[string]bool{
+	EventOnline:      true,
+	EventOffline:     true,
+	EventAuthFailed:  true,
+	EventLoggedOut:   true,
+	EventCircuitOpen: true,
+}
+
+type Event struct {
+	Type      string    `json:"type"`
+	Username  string    `json:"username"`
+	Interface string    `json:"interface"`
+	IP        string    `json:"ip,omitempty"`
+	Code      string    `json:"code,omitempty"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+}
+
+type Notifier interface {
+	Notify(event *Event) error
+}
+
+type NotifierConfig struct {
+	Type        string `json:"type"`
+	URL         string `json:"url"`
+	RateLimit   int    `json:"rate_limit"`
+	DedupWindow int    `json:"dedup_window"`
+	QuietHours  string `json:"quiet_hours"`
+	Source      string `json:"source"`
+}
+
+const NotifierWebhook = "webhook"
+
+var notifierRegistry = map[string]func(cfg *NotifierConfig) (Notifier, error){
+	NotifierWebhook: func(cfg *NotifierConfig) (Notifier, error) {
+		if err := validateEndpoint(cfg.URL); err != nil {
+			return nil, err
+		}
+		return NewWebhookNotifier(cfg.URL), nil
+	},
+}
+
+// validateEndpoint 检查通知地址是完整的 http/https 地址
+func validateEndpoint(URL string) error {
+	if URL == "" {
+		return errors.New("notifier url is empty")
+	}
+	parsed, err := url.Parse(URL)
+	if err != nil {
+		return fmt.Errorf("invalid notifier url %q: %v", URL, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("notifier url %q must use http or https", URL)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("notifier url %q has no host", URL)
+	}
+	return nil
+}
+
+// NewNotifier 按配置创建通知器，并套上限流、去重和免打扰
+func NewNotifier(cfg *NotifierConfig) (Notifier, error) {
+	factory, ok := notifierRegistry[cfg.Type]
+	if !ok {
+		return nil, errors.New("unknown notifier: " + cfg.Type)
+	}
+
+	quiet, err := ParseQuietHours(cfg.QuietHours)
+	if err != nil {
+		return nil, err
+	}
+
+	inner, err := factory(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ThrottledNotifier{
+		inner:       inner,
+		rateLimit:   cfg.RateLimit,
+		dedupWindow: time.Millisecond * time.Duration(cfg.DedupWindow),
+		quiet:       quiet,
+	}, nil
+}
+
+type WebhookNotifier struct {
+	URL    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(URL string) *WebhookNotifier {
+	return &WebhookNotifier{URL: URL, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (n *WebhookNotifier) Notify(event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(n.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// ThrottledNotifier 限制每小时发送数量，合并重复的相同通知，并在免打扰时段内丢弃通知
+type ThrottledNotifier struct {
+	inner       Notifier
+	rateLimit   int
+	dedupWindow time.Duration
+	quiet       *QuietHours
+
+	mu         sync.Mutex
+	sent       []time.Time
+	lastKey    string
+	lastTime   time.Time
+	suppressed int
+}
+
+var ErrNotifySuppressed = errors.New("notification suppressed")
+
+func (n *ThrottledNotifier) Notify(event *Event) error {
+	if !n.allow(event) {
+		return ErrNotifySuppressed
+	}
+	return n.inner.Notify(event)
+}
+
+// Close 关闭内层通知器持有的资源(如Windows事件日志句柄)
+func (n *ThrottledNotifier) Close() error {
+	if closer, ok := n.inner.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (n *ThrottledNotifier) allow(event *Event) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := event.Time
+	if n.quiet != nil && n.quiet.Contains(now) {
+		return false
+	}
+
+	key := event.Type + "\x00" + event.Message
+	if n.dedupWindow > 0 && key == n.lastKey && now.Sub(n.lastTime) < n.dedupWindow {
+		n.suppressed++
+		return false
+	}
+
+	if n.rateLimit > 0 {
+		kept := n.sent[:0]
+		for _, t := range n.sent {
+			if now.Sub(t) < time.Hour {
+				kept = append(kept, t)
+			}
+		}
+		n.sent = kept
+		if len(n.sent) >= n.rateLimit {
+			return false
+		}
+		n.sent = append(n.sent, now)
+	}
+
+	if n.suppressed > 0 {
+		event.Message += fmt.Sprintf(" (repeated %d times)", n.suppressed)
+		n.suppressed = 0
+	}
+	n.lastKey = key
+	n.lastTime = now
+	return true
+}
+
+// QuietHours 是每天的免打扰时段，结束时间早于开始时间表示跨过午夜
+type QuietHours struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseQuietHours 解析形如 "23:00-07:00" 的时段，空字符串表示不启用
+func ParseQuietHours(s string) (*QuietHours, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, errors.New("invalid quiet hours: " + s)
+	}
+
+	startOffset, err := parseClock(start)
+	if err != nil {
+		return nil, err
+	}
+	endOffset, err := parseClock(end)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QuietHours{Start: startOffset, End: endOffset}, nil
+}
+
+func (q *QuietHours) Contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if q.Start <= q.End {
+		return offset >= q.Start && offset < q.End
+	}
+	return offset >= q.Start || offset < q.End
+}
+
+func parseClock(s string) (time.Duration, error) {
+	hour, minute, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return 0, errors.New("invalid clock: " + s)
+	}
+	h, err := strconv.Atoi(hour)
+	if err != nil || h < 0 || h > 23 {
+		return 0, errors.New("invalid clock: " + s)
+	}
+	m, err := strconv.Atoi(minute)
+	if err != nil || m < 0 || m > 59 {
+		return 0, errors.New("invalid clock: " + s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// Notify 发布事件给订阅者，并异步交给该账号的所有通知器，发送失败只记录日志
+func (c *Client) Notify(eventType string, message string) {
+	c.Emit(&Event{Type: eventType, Message: message})
+}
+
+// notifyEvent 把需要通知的事件放入通知队列
+func (c *Client) notifyEvent(event *Event) {
+	if len(c.notifiers) == 0 || !notifiableEvents[event.Type] {
+		return
+	}
+
+	select {
+	case c.events <- event:
+	default:
+		c.Log.Println(T("notification queue full, drop event:"), event.Type)
+	}
+}
+
+// closeNotifiers 在客户端停止后释放通知器的资源，runNotifiers 是唯一调用 Notify 的 goroutine，退出时再关闭不会和发送冲突
+func (c *Client) closeNotifiers() {
+	for _, n := range c.notifiers {
+		if closer, ok := n.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+}
+
+// maxPendingNotifications 是离线期间最多缓存的通知条数，超出时丢弃最早的
+const maxPendingNotifications = 100
+
+type pendingNotification struct {
+	notifier Notifier
+	event    *Event
+}
+
+// runNotifiers 发送通知。处于未认证状态时发送失败的通知会按顺序缓存，带着原来的时间在重新认证后补发，
+// 这样掉线时的通知不会正好在需要它的时候丢失
+func (c *Client) runNotifiers() {
+	defer c.closeNotifiers()
+	var pending []pendingNotification
+	retry := time.NewTicker(30 * time.Second)
+	defer retry.Stop()
+
+	send := func(n Notifier, event *Event) {
+		e := *event
+		err := n.Notify(&e)
+		if err == nil || errors.Is(err, ErrNotifySuppressed) {
+			return
+		}
+		if c.Status().Online {
+			c.Log.Printf(T("notify %s error: %v"), event.Type, err)
+			return
+		}
+		// 已经通过限流的通知补发时直接交给内层通知器，避免被当作重复通知丢弃
+		if throttled, ok := n.(*ThrottledNotifier); ok {
+			n = throttled.inner
+		}
+		if len(pending) >= maxPendingNotifications {
+			pending = pending[1:]
+		}
+		pending = append(pending, pendingNotification{notifier: n, event: &e})
+	}
+
+	flush := func() {
+		if len(pending) == 0 || !c.Status().Online {
+			return
+		}
+		c.Log.Printf(T("delivering %d notifications queued while offline"), len(pending))
+		queued := pending
+		pending = nil
+		for _, p := range queued {
+			send(p.notifier, p.event)
+		}
+	}
+
+	for {
+		select {
+		case <-c.Ctx.Done():
+			return
+		case <-retry.C:
+			flush()
+		case event := <-c.events:
+			flush()
+			for _, n := range c.notifiers {
+				send(n, event)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+)
+
+const (
+	PasswordPlain        = "plain"
+	PasswordMD5          = "md5"
+	PasswordBase64       = "base64"
+	PasswordMD5Challenge = "md5_challenge"
+	PasswordAuto         = "auto"
+)
+
+// 重定向地址中可能携带的挑战值参数名
+var redirectChallengeKeys = []string{"challenge", "chal", "chap_challenge"}
+
+// validPasswordEncoding 判断 password_encoding 是否有效，留空为明文
+func validPasswordEncoding(encoding string) bool {
+	switch encoding {
+	case "", PasswordPlain, PasswordMD5, PasswordBase64, PasswordMD5Challenge, PasswordAuto:
+		return true
+	}
+	return false
+}
+
+// EncodePassword 按学校要求的方式处理密码。md5_challenge 为 md5(挑战值+密码)，结果均为小写十六进制
+func EncodePassword(encoding string, password string, challenge string) (string, error) {
+	switch encoding {
+	case PasswordPlain:
+		return password, nil
+	case PasswordMD5:
+		sum := md5.Sum([]byte(password))
+		return hex.EncodeToString(sum[:]), nil
+	case PasswordBase64:
+		return base64.StdEncoding.EncodeToString([]byte(password)), nil
+	case PasswordMD5Challenge:
+		if challenge == "" {
+			return "", errors.New("portal did not provide a challenge for md5_challenge password")
+		}
+		sum := md5.Sum([]byte(challenge + password))
+		return hex.EncodeToString(sum[:]), nil
+	}
+	return "", errors.New("unknown password encoding: " + encoding)
+}
+
+// portalPassword 返回提交给门户的密码。未配置 password_encoding 时为明文；
+// 配置为 auto 时重定向地址带挑战值则用 md5_challenge，否则明文
+func (c *Client) portalPassword(redirectURL string) (string, error) {
+	var challenge string
+	if parsed, err := url.Parse(redirectURL); err == nil {
+		challenge = firstQueryValue(parsed.Query(), redirectChallengeKeys)
+	}
+
+	encoding := c.Config.PasswordEncoding
+	switch {
+	case encoding == "":
+		encoding = PasswordPlain
+	case encoding == PasswordAuto && challenge != "":
+		encoding = PasswordMD5Challenge
+	case encoding == PasswordAuto:
+		encoding = PasswordPlain
+	}
+	password, err := EncodePassword(encoding, c.password(), challenge)
+	// md5、base64 等形式和明文一样可以直接登录，同样需要打码
+	RegisterSecret(password)
+	return password, err
+}
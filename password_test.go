@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestEncodePassword(t *testing.T) {
+	tests := []struct {
+		encoding  string
+		challenge string
+		want      string
+		wantErr   bool
+	}{
+		{encoding: PasswordPlain, want: "p@ss"},
+		{encoding: PasswordMD5, want: "195f19b835efe9f0b7b4e276ef1a8515"},
+		{encoding: PasswordBase64, want: "cEBzcw=="},
+		{encoding: PasswordMD5Challenge, challenge: "1a2b", want: "0654cc283220bc9b099f229c4ce21b55"},
+		{encoding: PasswordMD5Challenge, wantErr: true},
+		{encoding: "sha1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			got, err := EncodePassword(tt.encoding, "p@ss", tt.challenge)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EncodePassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("EncodePassword() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortalPasswordDefaultsToPlain(t *testing.T) {
+	redirect := "http://10.0.0.1/login?wlanuserip=10.1.2.3&challenge=1a2b"
+	tests := []struct {
+		encoding string
+		redirect string
+		want     string
+	}{
+		{"", redirect, "p@ss"},
+		{PasswordPlain, redirect, "p@ss"},
+		{PasswordAuto, redirect, "0654cc283220bc9b099f229c4ce21b55"},
+		{PasswordAuto, "http://10.0.0.1/login?wlanuserip=10.1.2.3", "p@ss"},
+		{PasswordMD5Challenge, redirect, "0654cc283220bc9b099f229c4ce21b55"},
+	}
+	for _, tt := range tests {
+		c := newTestClient(t, &Config{Password: "p@ss", PasswordEncoding: tt.encoding})
+		got, err := c.portalPassword(tt.redirect)
+		if err != nil || got != tt.want {
+			t.Errorf("password_encoding %q: portalPassword() = %q, %v, want %q", tt.encoding, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// Portal 是一种校园网门户协议的实现，Client 的主循环只通过它完成认证、保活和下线
+type Portal interface {
+	Auth(redirectURL string) error
+	Heartbeat() error
+	Logout() error
+}
+
+const (
+	PortalESurfing = "esurfing"
+	PortalSrun     = "srun"
+	PortalCMCC     = CarrierCMCC
+	PortalUnicom   = CarrierUnicom
+)
+
+var portalRegistry = map[string]func(c *Client) Portal{
+	PortalESurfing: func(c *Client) Portal { return newESurfingPortal(c) },
+	PortalSrun:     func(c *Client) Portal { return NewSrun(c) },
+	PortalCMCC:     func(c *Client) Portal { return NewCarrierPortal(c, CarrierCMCC) },
+	PortalUnicom:   func(c *Client) Portal { return NewCarrierPortal(c, CarrierUnicom) },
+	PortalWISPr:    func(c *Client) Portal { return NewWISPrPortal(c) },
+}
+
+func NewPortal(name string, c *Client) Portal {
+	if factory, ok := portalRegistry[name]; ok {
+		return factory(c)
+	}
+	return nil
+}
+
+// SessionKicker 由能够下线其他/残留会话的门户实现
+type SessionKicker interface {
+	KickSessions() error
+}
+
+var ErrDeviceLimit = errors.New("online device limit reached")
+
+var deviceLimitKeywords = []string{"终端数", "设备数", "在线数", "上限", "online_num", "too many", "device limit", "online limit"}
+
+// ErrAlreadyOnline 表示门户认为该账号/IP已经在线，通常是崩溃后残留的会话
+var ErrAlreadyOnline = errors.New("account already online")
+
+var alreadyOnlineKeywords = []string{"e2620", "已经在线", "已在线", "already_online", "already online"}
+
+// ErrBadCredentials 表示账号或密码错误、账号被禁用，重试不会成功，反而可能触发门户的错误次数限制
+var ErrBadCredentials = errors.New("bad credentials")
+
+var badCredentialsKeywords = []string{"e2531", "e2533", "e2553", "e2606", "用户不存在", "密码错误", "用户被禁用",
+	"user not found", "wrong password", "password is error", "account disabled"}
+
+// ErrChallengeExpired 表示认证用的ticket/挑战值已经过期，重新获取后可以立即重试
+var ErrChallengeExpired = errors.New("auth challenge expired")
+
+var challengeExpiredKeywords = []string{"challenge_expire", "challenge expired", "nonce", "ticket expired", "ticket invalid",
+	"invalid ticket", "ticket timeout", "票据过期", "票据无效", "ticket过期", "ticket无效", "挑战码过期"}
+
+// PortalError 是门户明确拒绝认证时返回的错误
+type PortalError struct {
+	Code    string
+	Message string
+}
+
+func (e *PortalError) Error() string {
+	return T("portal rejected auth:") + " " + TranslatePortalMessage(e.Code, e.Message)
+}
+
+func (e *PortalError) Is(target error) bool {
+	switch target {
+	case ErrDeviceLimit:
+		return containsAny(e.Code+" "+e.Message, deviceLimitKeywords)
+	case ErrAlreadyOnline:
+		return containsAny(e.Code+" "+e.Message, alreadyOnlineKeywords)
+	case ErrMaintenance:
+		return containsAny(e.Code+" "+e.Message, maintenanceKeywords)
+	case ErrBadCredentials:
+		return containsAny(e.Code+" "+e.Message, badCredentialsKeywords)
+	case ErrChallengeExpired:
+		return containsAny(e.Code+" "+e.Message, challengeExpiredKeywords)
+	}
+	return false
+}
+
+func containsAny(s string, keywords []string) bool {
+	s = strings.ToLower(s)
+	for _, keyword := range keywords {
+		if strings.Contains(s, keyword) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testPassword = "p@ssw0rd-secret"
+	testTicket   = "TICKET-5f2c9a7e41"
+	testAlgoID   = AlgoAesCbc
+)
+
+// fakeESurfingPortal 模拟天翼校园门户的完整认证流程：重定向、econfig、AlgoID、ticket和登录，
+// 报文按 testAlgoID 加密，登录时检查密码
+func fakeESurfingPortal(t *testing.T) *httptest.Server {
+	t.Helper()
+	c := NewCipher(testAlgoID)
+
+	decrypt := func(r *http.Request) []byte {
+		data, _ := io.ReadAll(r.Body)
+		plain, err := c.Decrypt(data)
+		if err != nil {
+			t.Errorf("%s: decrypt request: %v", r.URL.Path, err)
+		}
+		return plain
+	}
+	reply := func(w http.ResponseWriter, body string) {
+		data, err := c.Encrypt([]byte(body))
+		if err != nil {
+			t.Errorf("encrypt response: %v", err)
+		}
+		_, _ = w.Write(data)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("schoolid", "1234")
+		w.Header().Set("domain", "test.campus")
+		w.Header().Set("area", "gd")
+		w.Header().Set("Location", "/index")
+		w.WriteHeader(http.StatusFound)
+	})
+	mux.HandleFunc("/index", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "<html><body>"+ConfigStartTag+
+			"<config><ticket-url>/ticket?wlanuserip=10.1.2.3&amp;wlanacip=10.0.0.1</ticket-url>"+
+			"<auth-url>/auth</auth-url></config>"+ConfigEndTag+"</body></html>")
+	})
+	mux.HandleFunc("/ticket", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Algo-ID") == DefaultAlgoID {
+			_, _ = io.ReadAll(r.Body)
+			key := "k3y"
+			_, _ = w.Write(append(append([]byte{0, 0, 0, byte(len(key))}, key...), append([]byte{byte(len(testAlgoID))}, testAlgoID...)...))
+			return
+		}
+		decrypt(r)
+		reply(w, "<response><ticket>"+testTicket+"</ticket><expire>600</expire></response>")
+	})
+	mux.HandleFunc("/auth", func(w http.ResponseWriter, r *http.Request) {
+		login := &LoginRequest{}
+		if err := xml.Unmarshal(decrypt(r), login); err != nil {
+			t.Errorf("login request: %v", err)
+		}
+		if login.Passwd != testPassword || login.Ticket != testTicket {
+			reply(w, "<response><code>13</code><message>bad password</message></response>")
+			return
+		}
+		reply(w, "<response><keep-retry>240</keep-retry><keep-url>/keep</keep-url><term-url>/term</term-url></response>")
+	})
+	mux.HandleFunc("/term", func(w http.ResponseWriter, r *http.Request) {
+		decrypt(r)
+		reply(w, "<response><code>0</code></response>")
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestESurfingAuth(t *testing.T) {
+	server := fakeESurfingPortal(t)
+	e := NewESurfing(newTestClient(t, &Config{Password: testPassword}))
+
+	if err := e.Auth(server.URL + "/redirect?wlanuserip=10.1.2.3&wlanacip=10.0.0.1"); err != nil {
+		t.Fatalf("Auth: %v", err)
+	}
+	if !strings.HasSuffix(e.KeepUrl, "/keep") || !strings.HasSuffix(e.TermUrl, "/term") {
+		t.Fatalf("keep url %q, term url %q", e.KeepUrl, e.TermUrl)
+	}
+}
+
+func TestESurfingKicksSessionSavedByPreviousRun(t *testing.T) {
+	server := fakeESurfingPortal(t)
+	c := newTestClient(t, &Config{Password: testPassword})
+	if err := NewESurfing(c).Auth(server.URL + "/redirect?wlanuserip=10.1.2.3&wlanacip=10.0.0.1"); err != nil {
+		t.Fatalf("Auth: %v", err)
+	}
+	saved := c.loadState().Session
+	if saved == nil || saved.Ticket != testTicket || !strings.HasSuffix(saved.TermUrl, "/term") {
+		t.Fatalf("saved session = %+v", saved)
+	}
+
+	// 模拟崩溃后重启：新的实例没有本进程内的会话，只能用保存的
+	restarted := NewESurfing(c)
+	if err := restarted.KickSessions(); err != nil {
+		t.Fatalf("KickSessions: %v", err)
+	}
+	if c.loadState().Session != nil {
+		t.Error("session still saved after it was terminated")
+	}
+	if err := restarted.KickSessions(); err == nil {
+		t.Error("second KickSessions found a session to terminate")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// AccountProfile 是按所在网络切换使用的账号。ssid、gateway_mac、redirect_domain 中配置了的条件都满足时生效，
+// 按顺序取第一个，都不满足时使用配置本身的账号
+type AccountProfile struct {
+	Name           string `json:"name"`
+	SSID           string `json:"ssid"`
+	GatewayMAC     string `json:"gateway_mac"`
+	RedirectDomain string `json:"redirect_domain"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+}
+
+func validateProfiles(c *Config) error {
+	for _, p := range c.Profiles {
+		if p == nil {
+			return errors.New("empty profile")
+		}
+		if p.Name == "" {
+			p.Name = p.Username
+		}
+		if p.SSID == "" && p.GatewayMAC == "" && p.RedirectDomain == "" {
+			return errors.New("profile " + p.Name + " has no ssid, gateway_mac or redirect_domain")
+		}
+		if p.Username == "" || p.Password == "" {
+			return errors.New("profile " + p.Name + ": username or password is empty")
+		}
+		if p.GatewayMAC != "" {
+			mac, err := net.ParseMAC(p.GatewayMAC)
+			if err != nil {
+				return errors.New("profile " + p.Name + ": invalid gateway mac " + p.GatewayMAC)
+			}
+			p.GatewayMAC = mac.String()
+		}
+		p.RedirectDomain = strings.ToLower(strings.TrimPrefix(p.RedirectDomain, "."))
+	}
+	return nil
+}
+
+// networkIdentity 是用来匹配账号配置的当前网络特征
+type networkIdentity struct {
+	SSID       string
+	GatewayMAC string
+	Domain     string
+}
+
+func (n *networkIdentity) matches(p *AccountProfile) bool {
+	if p.SSID != "" && p.SSID != n.SSID {
+		return false
+	}
+	if p.GatewayMAC != "" && p.GatewayMAC != n.GatewayMAC {
+		return false
+	}
+	if p.RedirectDomain != "" && n.Domain != p.RedirectDomain && !strings.HasSuffix(n.Domain, "."+p.RedirectDomain) {
+		return false
+	}
+	return true
+}
+
+// identifyNetwork 读取匹配账号配置需要的网络特征，没有配置用到的条件不去读取
+func (c *Client) identifyNetwork(portalURL string) *networkIdentity {
+	n := &networkIdentity{}
+	if parsed, err := url.Parse(portalURL); err == nil {
+		n.Domain = strings.ToLower(parsed.Hostname())
+	}
+
+	needSSID := slices.ContainsFunc(c.Config.Profiles, func(p *AccountProfile) bool { return p.SSID != "" })
+	if needSSID {
+		if c.ssidPolled {
+			n.SSID = c.Status().SSID
+		} else {
+			n.SSID, _ = CurrentSSID(c.Config.BindInterface)
+		}
+	}
+
+	needMAC := slices.ContainsFunc(c.Config.Profiles, func(p *AccountProfile) bool { return p.GatewayMAC != "" })
+	if needMAC {
+		if gateway, err := GetDefaultGateway(c.Config.BindInterface); err == nil {
+			n.GatewayMAC, _ = GatewayMAC(gateway)
+		}
+	}
+	return n
+}
+
+// selectProfile 在认证前按当前网络选择账号。切换前先下线之前的账号认证过的会话，
+// 否则门户上会留下旧账号的会话，继续占用它的设备数
+func (c *Client) selectProfile(portalURL string) {
+	if len(c.Config.Profiles) == 0 {
+		return
+	}
+
+	var selected *AccountProfile
+	network := c.identifyNetwork(portalURL)
+	for _, p := range c.Config.Profiles {
+		if network.matches(p) {
+			selected = p
+			break
+		}
+	}
+	if selected == c.account {
+		return
+	}
+	if c.Status().AuthCount > 0 {
+		c.Log.Printf(T("logging out account %s before switching profiles"), c.username())
+		c.stopHeartbeat()
+		c.Logout()
+		c.setOnline(false)
+	}
+	c.account = selected
+
+	name := ""
+	if selected != nil {
+		name = selected.Name
+		c.Log.Printf(T("network matches profile %s, using account %s"), selected.Name, selected.Username)
+	} else {
+		c.Log.Println(T("no profile matches the current network, using the default account"))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.Profile = name
+	c.status.Username = c.username()
+}
+
+// username 返回当前网络使用的账号
+func (c *Client) username() string {
+	if c.account != nil {
+		return c.account.Username
+	}
+	return c.Config.Username
+}
+
+// password 返回当前网络使用的账号的密码
+func (c *Client) password() string {
+	if c.account != nil {
+		return c.account.Password
+	}
+	return c.Config.Password
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestSelectProfileLogsOutPreviousAccount(t *testing.T) {
+	c := newTestClient(t, &Config{
+		Username: "home-user",
+		Profiles: []*AccountProfile{{Name: "dorm", RedirectDomain: "dorm.example", Username: "dorm-user", Password: "dorm-pass"}},
+	})
+	portal := &countingPortal{}
+	c.portal = portal
+
+	// 还没有认证过，切换不需要下线
+	c.selectProfile("http://portal.dorm.example/redirect")
+	if portal.logouts != 0 || c.username() != "dorm-user" {
+		t.Fatalf("logouts = %d, username = %s", portal.logouts, c.username())
+	}
+
+	c.setAuthenticated()
+	c.selectProfile("http://portal.campus.example/redirect")
+	if portal.logouts != 1 {
+		t.Fatalf("switching away from an authenticated account sent %d logouts, want 1", portal.logouts)
+	}
+	if s := c.Status(); s.Online || s.Username != "home-user" {
+		t.Errorf("status after switching = online %v, username %s", s.Online, s.Username)
+	}
+
+	c.selectProfile("http://portal.campus.example/redirect")
+	if portal.logouts != 1 {
+		t.Error("selecting the same account again logged out")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	PushFormatPrometheus = "prometheus"
+	PushFormatInflux     = "influx"
+)
+
+// MetricsPusher 定时把指标推送到 Pushgateway 或 InfluxDB，用于没有采集端能抓取本机的路由器
+type MetricsPusher struct {
+	URL      string
+	Format   string
+	Token    string
+	Interval time.Duration
+
+	client *http.Client
+	done   chan struct{}
+}
+
+// StartMetricsPush 校验参数并开始定时推送，返回的 MetricsPusher 用于停止
+func StartMetricsPush(url string, format string, token string, interval time.Duration) (*MetricsPusher, error) {
+	switch format {
+	case PushFormatPrometheus, PushFormatInflux:
+	default:
+		return nil, errors.New("unknown push format: " + format)
+	}
+	if err := validateEndpoint(url); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, errors.New("push interval must be positive")
+	}
+
+	p := &MetricsPusher{
+		URL:      url,
+		Format:   format,
+		Token:    token,
+		Interval: interval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+func (p *MetricsPusher) run() {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			if err := p.Push(); err != nil {
+				log.Printf(T("push metrics error: %v"), err)
+			}
+		}
+	}
+}
+
+// String 返回隐藏了密码和token参数的推送地址，用于日志
+func (p *MetricsPusher) String() string {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return p.Format
+	}
+	u.RawQuery = redactValues(u.Query()).Encode()
+	return p.Format + " " + u.Redacted()
+}
+
+func (p *MetricsPusher) Stop() {
+	close(p.done)
+}
+
+// Push 立即推送一次当前的指标
+func (p *MetricsPusher) Push() error {
+	buf := &bytes.Buffer{}
+	contentType := "text/plain; version=0.0.4; charset=utf-8"
+	if p.Format == PushFormatInflux {
+		WriteInfluxLines(buf, time.Now())
+		contentType = "text/plain; charset=utf-8"
+	} else {
+		WriteMetrics(buf)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, p.URL, buf)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	if p.Token != "" {
+		scheme := "Bearer "
+		if p.Format == PushFormatInflux {
+			scheme = "Token "
+		}
+		request.Header.Set("Authorization", scheme+p.Token)
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+
+	if response.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// WriteInfluxLines 以 InfluxDB 行协议输出与 /metrics 相同的计数，每个账号一行
+func WriteInfluxLines(w io.Writer, now time.Time) {
+	for _, c := range SelectClients("") {
+		s := c.Status()
+		authLatency, heartbeatRTT := c.histograms()
+
+		var lastAuth int64
+		if !s.AuthTime.IsZero() {
+			lastAuth = s.AuthTime.Unix()
+		}
+
+		fmt.Fprintf(w,
+			"esurfing,username=%s,interface=%s online=%di,auth_success=%di,auth_failure=%di,heartbeat_success=%di,heartbeat_failure=%di,last_auth_timestamp=%di,session_rx_bytes=%di,session_tx_bytes=%di,auth_duration_sum=%g,auth_duration_count=%di,heartbeat_rtt_sum=%g,heartbeat_rtt_count=%di %d\n",
+			escapeInfluxTag(s.Username), escapeInfluxTag(s.Interface),
+			boolToInt(s.Online), s.AuthCount, s.AuthFailures, s.HeartbeatCount, s.HeartbeatFailures, lastAuth, s.SessionRxBytes, s.SessionTxBytes,
+			authLatency.Sum, authLatency.Count, heartbeatRTT.Sum, heartbeatRTT.Count,
+			now.UnixNano(),
+		)
+	}
+}
+
+var influxTagEscaper = strings.NewReplacer(",", "\\,", " ", "\\ ", "=", "\\=")
+
+func escapeInfluxTag(v string) string {
+	if v == "" {
+		return "none"
+	}
+	return influxTagEscaper.Replace(v)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// unsafeDebug 关闭所有打码，日志、状态和追踪中都会出现完整的密码和ticket，只应在本地排查问题时临时使用
+var unsafeDebug bool
+
+// secretValues 是运行中出现过的密码、ticket、ClientID等值，任何输出中出现时都会被替换
+var (
+	secretsMu    sync.RWMutex
+	secretValues = map[string]struct{}{}
+)
+
+// 太短的值很可能误伤普通文本，不登记
+const minSecretLength = 4
+
+// sensitiveParamPattern 匹配自由文本(如错误中的URL)中 名称包含 sensitiveParams 的 key=value
+var sensitiveParamPattern = regexp.MustCompile(`(?i)([\w-]*(?:` + strings.Join(sensitiveParams, "|") + `)[\w-]*=)([^&\s"'<>]+)`)
+
+// sensitiveFields 是门户报文(解密后的XML/JSON)中需要打码的字段
+var sensitiveFields = []string{"passwd", "password", "ticket", "client-id", "clientid"}
+
+// sensitiveFieldPattern 匹配 <ticket>...</ticket> 和 "ticket":"..." 形式的字段
+var sensitiveFieldPattern = regexp.MustCompile(`(?i)(<(?:` + strings.Join(sensitiveFields, "|") + `)>)[^<]*(</)|` +
+	`("(?:` + strings.Join(sensitiveFields, "|") + `)"\s*:\s*")[^"]*(")`)
+
+// RegisterSecret 登记一个需要在所有输出中隐藏的值
+func RegisterSecret(values ...string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, value := range values {
+		if len(value) >= minSecretLength && value != redactedValue {
+			secretValues[value] = struct{}{}
+		}
+	}
+}
+
+// Redact 返回隐藏了已登记的值、敏感URL参数和报文字段的文本，开启 -unsafe-debug 时原样返回
+func Redact(s string) string {
+	if unsafeDebug || s == "" {
+		return s
+	}
+
+	secretsMu.RLock()
+	for value := range secretValues {
+		if strings.Contains(s, value) {
+			s = strings.ReplaceAll(s, value, redactedValue)
+		}
+	}
+	secretsMu.RUnlock()
+
+	s = sensitiveParamPattern.ReplaceAllString(s, "${1}"+redactedValue)
+	return sensitiveFieldPattern.ReplaceAllString(s, "${1}${3}"+redactedValue+"${2}${4}")
+}
+
+// RedactError 返回打码后的错误文本，err 为空时返回空字符串
+func RedactError(err error) string {
+	if err == nil {
+		return ""
+	}
+	return Redact(err.Error())
+}
+
+// redactWriter 在写入前对每一行日志打码
+type redactWriter struct {
+	w io.Writer
+}
+
+func NewRedactWriter(w io.Writer) io.Writer {
+	return &redactWriter{w: w}
+}
+
+func (r *redactWriter) Write(p []byte) (int, error) {
+	if unsafeDebug {
+		return r.w.Write(p)
+	}
+	if _, err := r.w.Write([]byte(Redact(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
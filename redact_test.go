@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	RegisterSecret("registered-secret-value", "abc")
+
+	tests := []struct {
+		name, in, want string
+	}{
+		{"registered value", "ticket is registered-secret-value!", "ticket is ******!"},
+		{"short values are not registered", "abc def", "abc def"},
+		{"url param", "GET http://10.0.0.1/auth?user=alice&userpwd=hunter22&x=1", "GET http://10.0.0.1/auth?user=alice&userpwd=******&x=1"},
+		{"param name containing a keyword", "wlanacname=ac&x-ticket-id=42", "wlanacname=ac&x-ticket-id=******"},
+		{"param is case insensitive", "Password=Secret1 next", "Password=****** next"},
+		{"param value stops at quote", `"token=abcdef" ok`, `"token=******" ok`},
+		{"xml field", "<request><passwd>hunter22</passwd><user>alice</user></request>", "<request><passwd>******</passwd><user>alice</user></request>"},
+		{"xml ticket", "<ticket>T-1234</ticket>", "<ticket>******</ticket>"},
+		{"xml client id", "<client-id>0b2f</client-id>", "<client-id>******</client-id>"},
+		{"json field", `{"ticket": "T-1234","user":"alice"}`, `{"ticket": "******","user":"alice"}`},
+		{"json client id", `{"clientId":"0b2f"}`, `{"clientId":"******"}`},
+		{"plain text untouched", "portal https://10.0.0.1/ unreachable", "portal https://10.0.0.1/ unreachable"},
+		{"empty", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Redact(test.in); got != test.want {
+				t.Errorf("Redact(%q) = %q, want %q", test.in, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRedactUnsafeDebug(t *testing.T) {
+	unsafeDebug = true
+	t.Cleanup(func() { unsafeDebug = false })
+
+	in := "userpwd=hunter22 <ticket>T-1234</ticket>"
+	if got := Redact(in); got != in {
+		t.Errorf("Redact with -unsafe-debug = %q, want unchanged", got)
+	}
+}
+
+func TestExportSessionsRedactsByDefault(t *testing.T) {
+	c := newTestClient(t, &Config{})
+	c.session = &Session{Username: c.username(), Ticket: "TICKET-export-raw", ClientID: "CLIENT-export-raw"}
+	clientsMu.Lock()
+	clients = append(clients, c)
+	clientsMu.Unlock()
+	t.Cleanup(func() {
+		clientsMu.Lock()
+		clients = clients[:len(clients)-1]
+		clientsMu.Unlock()
+	})
+
+	if out := ExportSessions(c.username(), false); strings.Contains(out, "export-raw") || !strings.Contains(out, redactedValue) {
+		t.Errorf("ExportSessions(unsafe=false) = %s, want ticket and client id redacted", out)
+	}
+	if out := ExportSessions(c.username(), true); !strings.Contains(out, "TICKET-export-raw") {
+		t.Errorf("ExportSessions(unsafe=true) = %s, want the raw ticket", out)
+	}
+}
+
+func TestEmitRedactsMessage(t *testing.T) {
+	c := newTestClient(t, &Config{})
+	events, cancel := c.Subscribe(1)
+	defer cancel()
+
+	c.Notify(EventOffline, "Get http://10.0.0.1/keep?ticket=T-raw-1234: timeout")
+	event := <-events
+	if strings.Contains(event.Message, "T-raw-1234") {
+		t.Errorf("event message %q leaks the ticket", event.Message)
+	}
+}
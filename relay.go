@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/url"
+)
+
+// 重定向地址中表示终端MAC的参数名
+var redirectUserMacKeys = []string{"wlanusermac", "usermac", "user_mac", "mac"}
+
+// validateRelay 检查中继模式的下游设备地址，并统一MAC的格式
+func validateRelay(c *Config) error {
+	if c.RelayIP != "" && net.ParseIP(c.RelayIP).To4() == nil {
+		return errors.New("invalid relay ip: " + c.RelayIP)
+	}
+	if c.RelayMAC != "" {
+		mac, err := net.ParseMAC(c.RelayMAC)
+		if err != nil {
+			return errors.New("invalid relay mac: " + c.RelayMAC)
+		}
+		c.RelayMAC = mac.String()
+	}
+	return nil
+}
+
+// RelayURL 中继模式下把门户地址中的终端IP/MAC替换为下游设备的地址，
+// 使门户为下游设备而不是路由器本身建立会话；之后再按 redirect_params 覆盖其中已有的参数
+func (c *Client) RelayURL(URL string) string {
+	if c.Config.RelayIP == "" && c.Config.RelayMAC == "" && len(c.Config.RedirectParams) == 0 {
+		return URL
+	}
+
+	parsed, err := url.Parse(URL)
+	if err != nil {
+		return URL
+	}
+
+	query := parsed.Query()
+	replace := func(keys []string, value string) {
+		if value == "" {
+			return
+		}
+		for _, key := range keys {
+			if query.Has(key) {
+				query.Set(key, value)
+			}
+		}
+	}
+	replace(redirectUserIPKeys, c.Config.RelayIP)
+	replace(redirectUserMacKeys, c.Config.RelayMAC)
+	for key, value := range c.Config.RedirectParams {
+		replace([]string{key}, value)
+	}
+
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
@@ -5,16 +5,23 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 func (c *Client) NewGetRequest(url string) (request *http.Request, err error) {
-	req, err := http.NewRequestWithContext(c.Ctx, http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(c.requestContext(), http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("User-Agent", UserAgentAndroid)
+	req.Header.Set("User-Agent", c.emulation.UserAgent)
 	req.Header.Set("Accept", "text/html,text/xml,application/xhtml+xml,application/x-javascript,*/*")
 	req.Header.Set("Client-ID", c.ClientID.String())
 	req.Header.Set("Connection", "keep-alive")
@@ -32,13 +39,17 @@ func (c *Client) NewGetRequest(url string) (request *http.Request, err error) {
 }
 
 func (c *Client) NewPostRequest(url string, data []byte) (request *http.Request, err error) {
+	return c.NewPostRequestWithCustomCtx(c.requestContext(), url, data)
+}
+
+func (c *Client) NewPostRequestWithCustomCtx(ctx context.Context, url string, data []byte) (request *http.Request, err error) {
 	md5Hex := md5.Sum(data)
 
-	req, err := http.NewRequestWithContext(c.Ctx, http.MethodPost, url, bytes.NewBuffer(data))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("User-Agent", UserAgentAndroid)
+	req.Header.Set("User-Agent", c.emulation.UserAgent)
 	req.Header.Set("Accept", "text/html,text/xml,application/xhtml+xml,application/x-javascript,*/*")
 	req.Header.Set("Client-ID", c.ClientID.String())
 	req.Header.Set("CDC-Checksum", hex.EncodeToString(md5Hex[:]))
@@ -46,17 +57,145 @@ func (c *Client) NewPostRequest(url string, data []byte) (request *http.Request,
 	return req, nil
 }
 
-func (c *Client) NewPostRequestWithCustomCtx(ctx context.Context, url string, data []byte) (request *http.Request, err error) {
-	md5Hex := md5.Sum(data)
+// requestContext 是门户请求使用的 context。平时为 c.Ctx，取消后所有进行中的请求立即返回；
+// 退出时的下线请求使用 shutdownLogout 设置的独立短超时
+func (c *Client) requestContext() context.Context {
+	if c.reqCtx != nil {
+		return c.reqCtx
+	}
+	return c.Ctx
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(data))
+// sleep 等待指定时间，c.Ctx 取消时提前返回错误
+func (c *Client) sleep(d time.Duration) error {
+	select {
+	case <-c.requestContext().Done():
+		return c.requestContext().Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// Do 发送请求，遇到连接重置、超时、502/503等临时错误时按退避间隔有限次重试。
+// 登录等POST请求只在请求还没有发出时重试，见 isTransient
+func (c *Client) Do(request *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		var written atomic.Bool
+		trace := &httptrace.ClientTrace{WroteRequest: func(httptrace.WroteRequestInfo) { written.Store(true) }}
+		response, err := c.doOnce(request.WithContext(httptrace.WithClientTrace(request.Context(), trace)))
+		if attempt >= c.Config.RequestRetries || !isTransient(request, response, err, written.Load()) {
+			return response, err
+		}
+
+		if response != nil {
+			_ = response.Body.Close()
+			err = errors.New(response.Status)
+		}
+		backoff := time.Millisecond * time.Duration(500<<attempt)
+		c.Log.Printf(T("request %s failed: %v, retry in %v"), request.URL.Host, err, backoff)
+
+		select {
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		case <-time.After(backoff):
+		}
+
+		if request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			request = request.Clone(request.Context())
+			request.Body = body
+		}
+	}
+}
+
+// isTransient 判断请求是否值得重试。GET/HEAD 遇到临时错误都可以重试；其余请求(提交凭据的ticket、登录等POST)
+// 在请求发出后门户可能已经处理过，重新提交会再次计入失败次数甚至锁定账号，因此只在请求还没写出时重试
+func isTransient(request *http.Request, response *http.Response, err error, written bool) bool {
+	if request.Context().Err() != nil {
+		return false
+	}
+	if request.Method != http.MethodGet && request.Method != http.MethodHead && (err == nil || written) {
+		return false
+	}
+	if err == nil {
+		switch response.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// doOnce 为单个请求附加配置的总超时，超时从发出请求一直计算到读完响应
+func (c *Client) doOnce(request *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(request.Context(), time.Millisecond*time.Duration(c.Config.RequestTimeout))
+
+	if traceHTTP {
+		c.traceRequest(request)
+	}
+	start := time.Now()
+
+	response, err := c.HttpClient.Do(request.WithContext(ctx))
+	if traceHTTP {
+		c.traceResponse(request, response, err, time.Since(start))
+	}
 	if err != nil {
+		cancel()
 		return nil, err
 	}
-	req.Header.Set("User-Agent", UserAgentAndroid)
-	req.Header.Set("Accept", "text/html,text/xml,application/xhtml+xml,application/x-javascript,*/*")
-	req.Header.Set("Client-ID", c.ClientID.String())
-	req.Header.Set("CDC-Checksum", hex.EncodeToString(md5Hex[:]))
-	req.Header.Set("Algo-ID", c.AlgoID)
-	return req, nil
+
+	if response.ContentLength > maxResponseSize {
+		_ = response.Body.Close()
+		cancel()
+		return nil, ErrResponseTooLarge
+	}
+	response.Body = &cancelOnClose{ReadCloser: &limitedBody{ReadCloser: response.Body, remaining: maxResponseSize}, cancel: cancel}
+	return response, nil
+}
+
+// maxResponseSize 是读取单个门户响应的上限。网关可能被同一局域网内的设备冒充，不能无限制地把响应读入内存
+const maxResponseSize = 1 << 20
+
+var ErrResponseTooLarge = errors.New("portal response too large")
+
+// limitedBody 在响应超过 remaining 字节时返回 ErrResponseTooLarge，而不是像 io.LimitReader 那样静默截断
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = 0
+		return n, ErrResponseTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	// 读完剩余的少量数据，连接才能放回连接池复用
+	_, _ = io.Copy(io.Discard, io.LimitReader(b.ReadCloser, 4096))
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
 }
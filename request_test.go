@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// resetOnceServer 在第一次请求读完请求体后直接断开连接，之后正常响应
+func resetOnceServer(t *testing.T, hits *atomic.Int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		if hits.Add(1) == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				_ = conn.Close()
+			}
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDoRetriesGetAfterReset(t *testing.T) {
+	var hits atomic.Int32
+	server := resetOnceServer(t, &hits)
+	c := newTestClient(t, &Config{})
+
+	request, err := c.NewGetRequest(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := c.Do(request)
+	if err != nil {
+		t.Fatalf("GET was not retried: %v", err)
+	}
+	_ = response.Body.Close()
+	if hits.Load() != 2 {
+		t.Fatalf("server saw %d requests, want 2", hits.Load())
+	}
+}
+
+func TestDoDoesNotResubmitWrittenPost(t *testing.T) {
+	var hits atomic.Int32
+	server := resetOnceServer(t, &hits)
+	c := newTestClient(t, &Config{})
+
+	request, err := c.NewPostRequest(server.URL, []byte("<login/>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := c.Do(request)
+	if err == nil {
+		_ = response.Body.Close()
+		t.Fatal("POST succeeded, want the reset to be returned")
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("server saw %d requests, want the login submitted once", hits.Load())
+	}
+}
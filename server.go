@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StartHTTPServer 启动本地的 HTTP 监听，提供指标、状态和控制接口。
+// token 不为空时所有接口都要求 `Authorization: Bearer <token>`，控制接口只在设置了 token 时开放；
+// certFile/keyFile 不为空时使用HTTPS
+func StartHTTPServer(addr string, token string, certFile string, keyFile string) (*http.Server, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("both tls cert and key are required")
+	}
+	var tlsConfig *tls.Config
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load tls cert: %w", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	RegisterSecret(token)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteMetrics(w)
+	})
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/livez", handleLivez)
+	mux.HandleFunc("/status", handleStatus)
+	mux.HandleFunc("/logs", func(w http.ResponseWriter, r *http.Request) {
+		handleLogs(w, r, token != "")
+	})
+	mux.HandleFunc("/control", func(w http.ResponseWriter, r *http.Request) {
+		handleControl(w, r, token != "")
+	})
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" && !isLoopbackListener(listener) {
+		log.Printf(T("http api on %s has no token, anyone on the network can read the status"), listener.Addr())
+	}
+
+	server := &http.Server{
+		Handler:           requireToken(token, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         tlsConfig,
+	}
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf(T("http server error: %v"), err)
+		}
+	}()
+	return server, nil
+}
+
+// requireToken 在 token 不为空时拒绝没有携带正确 bearer token 的请求，比较使用常数时间。
+// 浏览器的WebSocket无法设置请求头，WebSocket请求也可以用 ?access_token= 携带
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if authorization == "" && isWebsocketUpgrade(r) && r.URL.Query().Has("access_token") {
+			authorization = "Bearer " + r.URL.Query().Get("access_token")
+		}
+		if subtle.ConstantTimeCompare([]byte(authorization), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="esurfing"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isLoopbackListener(listener net.Listener) bool {
+	addr, ok := listener.Addr().(*net.TCPAddr)
+	return ok && addr.IP.IsLoopback()
+}
+
+// handleStatus 以与 -status 状态文件相同的JSON输出账号状态，可用 ?username= 指定账号
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(statusSnapshot(r.URL.Query().Get("username")))
+}
+
+// handleControl 以POST接收与控制socket相同的一行命令 `<command> [username]`。
+// 这些命令可以让账号下线，没有设置 token 时不开放
+func handleControl(w http.ResponseWriter, r *http.Request, authenticated bool) {
+	if !authenticated {
+		http.Error(w, "control api requires -api-token", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	line, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	command, target, _ := strings.Cut(strings.TrimSpace(string(line)), " ")
+	if command == "" {
+		http.Error(w, "empty command", http.StatusBadRequest)
+		return
+	}
+	// 完整的会话可以直接冒用，只允许通过本机的控制socket导出
+	if command == CommandSessionUnsafe {
+		http.Error(w, "session-unsafe is only available on the control socket", http.StatusForbidden)
+		return
+	}
+
+	reply := ExecuteCommand(command, strings.TrimSpace(target))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if strings.HasPrefix(reply, "error:") {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	_, _ = w.Write([]byte(reply))
+}
+
+// handleHealthz 只有账号都已认证且最近一次心跳成功时才返回200，可用 ?username= 指定账号
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	selected := SelectClients(r.URL.Query().Get("username"))
+	if len(selected) == 0 {
+		http.Error(w, "no such client", http.StatusNotFound)
+		return
+	}
+
+	var reasons []string
+	for _, c := range selected {
+		if reason := c.Status().Ready(); reason != "" {
+			reasons = append(reasons, c.Config.Username+": "+reason)
+		}
+	}
+	writeProbeResult(w, reasons)
+}
+
+// handleLivez 在所有账号的主循环都仍在运转时返回200
+func handleLivez(w http.ResponseWriter, r *http.Request) {
+	selected := SelectClients(r.URL.Query().Get("username"))
+	if len(selected) == 0 {
+		http.Error(w, "no such client", http.StatusNotFound)
+		return
+	}
+
+	var reasons []string
+	for _, c := range selected {
+		if !c.Alive() {
+			reasons = append(reasons, c.Config.Username+": loop stalled")
+		}
+	}
+	writeProbeResult(w, reasons)
+}
+
+func writeProbeResult(w http.ResponseWriter, reasons []string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(reasons) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(strings.Join(reasons, "\n") + "\n"))
+		return
+	}
+	_, _ = w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Session 是一次认证得到的会话信息，可以导出用于排查问题或交给其他工具继续保活
+type Session struct {
+	Username          string    `json:"username"`
+	Portal            string    `json:"portal"`
+	ClientID          string    `json:"client_id"`
+	Hostname          string    `json:"hostname"`
+	MacAddress        string    `json:"mac_address"`
+	UserIP            string    `json:"user_ip"`
+	AcIP              string    `json:"ac_ip"`
+	Domain            string    `json:"domain"`
+	Area              string    `json:"area"`
+	SchoolID          string    `json:"school_id"`
+	AlgoID            string    `json:"algo_id"`
+	Ticket            string    `json:"ticket"`
+	IndexUrl          string    `json:"index_url"`
+	TicketUrl         string    `json:"ticket_url"`
+	AuthUrl           string    `json:"auth_url"`
+	KeepUrl           string    `json:"keep_url"`
+	TermUrl           string    `json:"term_url"`
+	RedirectUrl       string    `json:"redirect_url"`
+	HeartbeatInterval int       `json:"heartbeat_interval"`
+	AuthTime          time.Time `json:"auth_time"`
+	ExportedAt        time.Time `json:"exported_at"`
+}
+
+// SessionImporter 由支持接管已有会话的门户实现，成功后直接开始保活而不重新登录
+type SessionImporter interface {
+	ImportSession(s *Session) error
+}
+
+type sessionImport struct {
+	session *Session
+	result  chan error
+}
+
+// snapshotSession 在客户端协程中复制当前的会话字段
+func (c *Client) snapshotSession() *Session {
+	return &Session{
+		Username:    c.username(),
+		Portal:      c.Config.Portal,
+		ClientID:    c.ClientID.String(),
+		Hostname:    c.Hostname,
+		MacAddress:  c.MacAddress,
+		UserIP:      c.UserIP,
+		AcIP:        c.AcIP,
+		Domain:      c.Domain,
+		Area:        c.Area,
+		SchoolID:    c.SchoolID,
+		AlgoID:      c.AlgoID,
+		Ticket:      c.Ticket,
+		IndexUrl:    c.IndexUrl,
+		TicketUrl:   c.TicketUrl,
+		AuthUrl:     c.AuthUrl,
+		KeepUrl:     c.KeepUrl,
+		TermUrl:     c.TermUrl,
+		RedirectUrl: c.RedirectUrl,
+	}
+}
+
+// Session 返回最近一次认证成功的会话，离线后返回nil
+func (c *Client) Session() *Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session == nil {
+		return nil
+	}
+
+	s := *c.session
+	s.HeartbeatInterval = int(c.status.HeartbeatInterval / time.Second)
+	s.AuthTime = c.status.AuthTime
+	s.ExportedAt = time.Now()
+	return &s
+}
+
+// Redact 隐藏会话中可以直接用来冒用会话的字段
+func (s *Session) Redact() {
+	if s.Ticket != "" {
+		s.Ticket = redactedValue
+	}
+	if s.ClientID != "" {
+		s.ClientID = redactedValue
+	}
+}
+
+// ExportSessions 返回选中账号的会话JSON，unsafe 为 false 时隐藏ticket和ClientID
+func ExportSessions(target string, unsafe bool) string {
+	sessions := []*Session{}
+	for _, c := range SelectClients(target) {
+		if s := c.Session(); s != nil {
+			if !unsafe {
+				s.Redact()
+			}
+			sessions = append(sessions, s)
+		}
+	}
+
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		return "error: " + err.Error() + "\n"
+	}
+	return string(data) + "\n"
+}
+
+// RunSessionExport 实现 `session export [username] [-unsafe]`，通过控制socket读取运行中进程的会话。
+// 默认隐藏ticket和ClientID，-unsafe 导出可以被 session import 接管的完整会话
+func RunSessionExport(args []string) error {
+	var target string
+	command := CommandSession
+	for _, arg := range args {
+		if arg == "-unsafe" || arg == "--unsafe" {
+			command = CommandSessionUnsafe
+		} else {
+			target = arg
+		}
+	}
+
+	if controlSocketPath == "" {
+		return errors.New("session export requires -control of the running process")
+	}
+	reply, err := SendControlCommand(controlSocketPath, command+" "+target)
+	if err != nil {
+		return err
+	}
+
+	var sessions []*Session
+	if err = json.Unmarshal([]byte(reply), &sessions); err != nil {
+		return fmt.Errorf("unexpected reply: %s", reply)
+	}
+	if len(sessions) == 0 {
+		return errors.New("no authenticated session")
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sessions)
+}
+
+// ImportSession 把导入的会话交给客户端协程处理并等待结果
+func (c *Client) ImportSession(s *Session) error {
+	req := &sessionImport{session: s, result: make(chan error, 1)}
+
+	c.mu.Lock()
+	c.pendingImport = req
+	c.mu.Unlock()
+
+	if !c.Send(CommandImport) {
+		return errors.New("client busy")
+	}
+
+	select {
+	case err := <-req.result:
+		return err
+	case <-c.Ctx.Done():
+		return c.Ctx.Err()
+	case <-time.After(time.Minute):
+		return errors.New("import timed out")
+	}
+}
+
+// handleImport 在客户端协程中校验并接管导入的会话
+func (c *Client) handleImport() {
+	c.mu.Lock()
+	req := c.pendingImport
+	c.pendingImport = nil
+	c.mu.Unlock()
+	if req == nil {
+		return
+	}
+
+	err := c.importSession(req.session)
+	if err != nil {
+		c.Log.Printf(T("session import failed: %v"), err)
+	} else {
+		c.Log.Println(T("session imported, heartbeat resumed"))
+	}
+	req.result <- err
+}
+
+func (c *Client) importSession(s *Session) error {
+	importer, ok := c.portal.(SessionImporter)
+	if !ok {
+		return fmt.Errorf("portal %s does not support session import", c.Config.Portal)
+	}
+	if s.Username != c.username() {
+		return fmt.Errorf("session belongs to %s", s.Username)
+	}
+	if s.Ticket == redactedValue || s.ClientID == redactedValue {
+		return errors.New("session is redacted")
+	}
+
+	localIP, err := c.sessionLocalIP()
+	if err != nil {
+		return err
+	}
+	if s.UserIP != localIP {
+		return fmt.Errorf("session user ip %s does not match current ip %s", s.UserIP, localIP)
+	}
+
+	c.stopHeartbeat()
+	if err = importer.ImportSession(s); err != nil {
+		return err
+	}
+
+	c.setPaused(false)
+	c.setAuthenticated()
+	c.startTrafficSession()
+	return nil
+}
+
+// sessionLocalIP 返回门户看到的本机地址：中继模式下为下游设备地址，否则为绑定或默认路由网卡的地址
+func (c *Client) sessionLocalIP() (string, error) {
+	if c.Config.RelayIP != "" {
+		return c.Config.RelayIP, nil
+	}
+
+	ip, err := BindLocalIP(c.Config)
+	if err != nil {
+		return "", err
+	}
+	if ip != nil {
+		return ip.String(), nil
+	}
+
+	iFace, err := DefaultRouteInterface()
+	if err != nil {
+		return "", err
+	}
+	return GetInterfaceIP(iFace)
+}
+
+// RunSessionImport 实现 `session import <file>`，把导出的会话交给运行中的进程接管
+func RunSessionImport(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: session import <file>")
+	}
+	if controlSocketPath == "" {
+		return errors.New("session import requires -control of the running process")
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	var sessions []*Session
+	if err = json.Unmarshal(data, &sessions); err != nil {
+		var single Session
+		if json.Unmarshal(data, &single) != nil {
+			return fmt.Errorf("invalid session file: %v", err)
+		}
+		sessions = []*Session{&single}
+	}
+
+	failed := false
+	for _, s := range sessions {
+		line, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		reply, err := SendControlCommand(controlSocketPath, CommandImport+" "+string(line))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s", s.Username, reply)
+		if reply != "ok\n" {
+			failed = true
+		}
+	}
+	if failed {
+		return errors.New("session import failed")
+	}
+	return nil
+}
+
+// importSessionCommand 处理控制socket收到的导入命令
+func importSessionCommand(data string) string {
+	var s Session
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		return "error: invalid session: " + err.Error() + "\n"
+	}
+
+	var client *Client
+	for _, c := range SelectClients("") {
+		if c.Status().Username == s.Username {
+			client = c
+		}
+	}
+	if client == nil {
+		return "error: no such client\n"
+	}
+
+	if err := client.ImportSession(&s); err != nil {
+		return "error: " + err.Error() + "\n"
+	}
+	return "ok\n"
+}
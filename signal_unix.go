@@ -0,0 +1,27 @@
+//go:build !windows
+
+package main
+
+import (
+	"log"
+	"os"
+	"syscall"
+)
+
+// SIGUSR1 输出所有账号的状态，SIGUSR2 强制所有账号下线并重新认证
+var controlSignals = []os.Signal{syscall.SIGUSR1, syscall.SIGUSR2}
+
+func HandleControlSignal(sig os.Signal) bool {
+	switch sig {
+	case syscall.SIGUSR1:
+		for _, c := range SelectClients("") {
+			c.Log.Println(T("status:"), FormatStatus(c.Status()))
+		}
+		return true
+	case syscall.SIGUSR2:
+		log.Println(T("forced re-authentication requested"))
+		ExecuteCommand(CommandRelogin, "")
+		return true
+	}
+	return false
+}
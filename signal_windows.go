@@ -0,0 +1,9 @@
+package main
+
+import "os"
+
+var controlSignals []os.Signal
+
+func HandleControlSignal(sig os.Signal) bool {
+	return false
+}
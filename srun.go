@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SrunVersion3000 = "3000"
+	SrunVersion4000 = "4000"
+
+	srunCallback = "jQuery112406118340540763985_1556004912581"
+	srunN        = "200"
+	srunType     = "1"
+	srunEncVer   = "srun_bx1"
+)
+
+var srunBase64 = base64.NewEncoding("LVoJPiCN2R8G90yg+hmFHuacZ1OWMnrsSTXkYpUq/3dlbfKwv6xztjI7DeBE45QA")
+
+type Srun struct {
+	*Client
+
+	BaseUrl  string
+	AcID     string
+	IP       string
+	LoggedIn bool
+}
+
+type SrunChallengeResponse struct {
+	Challenge string `json:"challenge"`
+	ClientIP  string `json:"client_ip"`
+	OnlineIP  string `json:"online_ip"`
+	Error     string `json:"error"`
+	ErrorMsg  string `json:"error_msg"`
+}
+
+type SrunPortalResponse struct {
+	Error    string `json:"error"`
+	ErrorMsg string `json:"error_msg"`
+	Res      string `json:"res"`
+	SucMsg   string `json:"suc_msg"`
+	ClientIP string `json:"client_ip"`
+	OnlineIP string `json:"online_ip"`
+}
+
+type srunInfo struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	IP       string `json:"ip"`
+	AcID     string `json:"acid"`
+	EncVer   string `json:"enc_ver"`
+}
+
+func NewSrun(c *Client) *Srun {
+	return &Srun{Client: c}
+}
+
+func (s *Srun) Auth(URL string) error {
+	parsed, err := url.Parse(URL)
+	if err != nil {
+		return err
+	}
+	if parsed.Host == "" {
+		return errors.New("missing srun portal host")
+	}
+
+	s.BaseUrl = parsed.Scheme + "://" + parsed.Host
+	s.AcID = s.Config.SrunAcID
+	if s.AcID == "" {
+		s.AcID = parsed.Query().Get("ac_id")
+	}
+	if s.AcID == "" {
+		s.AcID = "1"
+	}
+	s.IP = parsed.Query().Get("ip")
+	if s.IP == "" {
+		s.IP = parsed.Query().Get("wlanuserip")
+	}
+
+	s.Log.Println(T("srun portal:"), s.BaseUrl, "ac_id:", s.AcID)
+
+	if s.Config.SrunVersion == SrunVersion3000 {
+		err = s.Login3000()
+	} else {
+		err = s.Login4000()
+		if errors.Is(err, ErrChallengeExpired) {
+			s.Log.Printf(T("challenge expired, fetching a new challenge: %v"), err)
+			err = s.Login4000()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	s.LoggedIn = true
+	return nil
+}
+
+func (s *Srun) Login4000() error {
+	username := s.username()
+
+	challenge, err := s.GetChallenge()
+	if err != nil {
+		return err
+	}
+
+	token := challenge.Challenge
+	if s.IP == "" {
+		s.IP = challenge.ClientIP
+	}
+	if s.IP == "" {
+		s.IP = challenge.OnlineIP
+	}
+	s.UserIP = s.IP
+
+	info, err := srunEncodeInfo(&srunInfo{
+		Username: username,
+		Password: s.password(),
+		IP:       s.IP,
+		AcID:     s.AcID,
+		EncVer:   srunEncVer,
+	}, token)
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(md5.New, []byte(token))
+	mac.Write([]byte(s.password()))
+	hmd5 := hex.EncodeToString(mac.Sum(nil))
+
+	checksum := sha1.Sum([]byte(token + username + token + hmd5 + token + s.AcID + token + s.IP +
+		token + srunN + token + srunType + token + info))
+
+	query := url.Values{}
+	query.Set("callback", srunCallback)
+	query.Set("action", "login")
+	query.Set("username", username)
+	query.Set("password", "{MD5}"+hmd5)
+	query.Set("os", "Linux")
+	query.Set("name", "Linux")
+	query.Set("double_stack", "0")
+	query.Set("chksum", hex.EncodeToString(checksum[:]))
+	query.Set("info", info)
+	query.Set("ac_id", s.AcID)
+	query.Set("ip", s.IP)
+	query.Set("n", srunN)
+	query.Set("type", srunType)
+	query.Set("_", strconv.FormatInt(time.Now().UnixMilli(), 10))
+
+	resp := &SrunPortalResponse{}
+	if err = s.GetJSONP("/cgi-bin/srun_portal", query, resp); err != nil {
+		return err
+	}
+
+	if resp.Error != "ok" {
+		return &PortalError{Code: resp.Error, Message: resp.ErrorMsg}
+	}
+
+	s.Log.Println(T("srun login:"), resp.SucMsg)
+	return nil
+}
+
+func (s *Srun) GetChallenge() (*SrunChallengeResponse, error) {
+	query := url.Values{}
+	query.Set("callback", srunCallback)
+	query.Set("username", s.username())
+	query.Set("ip", s.IP)
+	query.Set("_", strconv.FormatInt(time.Now().UnixMilli(), 10))
+
+	resp := &SrunChallengeResponse{}
+	if err := s.GetJSONP("/cgi-bin/get_challenge", query, resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Challenge == "" {
+		return nil, fmt.Errorf("srun get challenge failed: %s %s", resp.Error, resp.ErrorMsg)
+	}
+
+	return resp, nil
+}
+
+func (s *Srun) Login3000() error {
+	form := url.Values{}
+	form.Set("action", "login")
+	form.Set("username", s.username())
+	form.Set("password", srun3000EncodePassword(s.password()))
+	form.Set("ac_id", s.AcID)
+	form.Set("type", "3")
+	form.Set("n", "117")
+	form.Set("drop", "0")
+	form.Set("pop", "1")
+	form.Set("mbytes", "0")
+	form.Set("minutes", "0")
+
+	data, err := s.PostForm("/cgi-bin/srun_portal", form)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(string(data), "login_ok") {
+		return &PortalError{Message: strings.TrimSpace(string(data))}
+	}
+
+	return nil
+}
+
+func (s *Srun) Heartbeat() error {
+	return nil
+}
+
+func (s *Srun) Logout() error {
+	if !s.LoggedIn {
+		return nil
+	}
+	s.LoggedIn = false
+
+	if s.Config.SrunVersion == SrunVersion3000 {
+		form := url.Values{}
+		form.Set("action", "logout")
+		form.Set("username", s.username())
+		form.Set("ac_id", s.AcID)
+		form.Set("type", "2")
+		_, err := s.PostForm("/cgi-bin/srun_portal", form)
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("callback", srunCallback)
+	query.Set("action", "logout")
+	query.Set("username", s.username())
+	query.Set("ac_id", s.AcID)
+	query.Set("ip", s.IP)
+	query.Set("_", strconv.FormatInt(time.Now().UnixMilli(), 10))
+
+	return s.GetJSONP("/cgi-bin/srun_portal", query, &SrunPortalResponse{})
+}
+
+// KickSessions 调用 rad_user_dm 接口下线该账号在当前IP上的会话
+func (s *Srun) KickSessions() error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	sign := sha1.Sum([]byte(timestamp + s.username() + s.IP + "1" + timestamp))
+
+	query := url.Values{}
+	query.Set("callback", srunCallback)
+	query.Set("ip", s.IP)
+	query.Set("username", s.username())
+	query.Set("time", timestamp)
+	query.Set("unbind", "1")
+	query.Set("sign", hex.EncodeToString(sign[:]))
+
+	resp := &SrunPortalResponse{}
+	if err := s.GetJSONP("/cgi-bin/rad_user_dm", query, resp); err != nil {
+		return err
+	}
+	if resp.Error != "ok" {
+		return &PortalError{Code: resp.Error, Message: resp.ErrorMsg}
+	}
+	return nil
+}
+
+func (s *Srun) GetJSONP(path string, query url.Values, v any) error {
+	request, err := s.NewGetRequest(s.BaseUrl + path + "?" + query.Encode())
+	if err != nil {
+		return err
+	}
+
+	response, err := s.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	start := bytes.IndexByte(data, '(')
+	end := bytes.LastIndexByte(data, ')')
+	if start < 0 || end <= start {
+		return fmt.Errorf("invalid srun response: %s", strings.TrimSpace(string(data)))
+	}
+
+	return json.Unmarshal(data[start+1:end], v)
+}
+
+func (s *Srun) PostForm(path string, form url.Values) ([]byte, error) {
+	request, err := http.NewRequestWithContext(s.requestContext(), http.MethodPost, s.BaseUrl+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := s.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+
+	return io.ReadAll(response.Body)
+}
+
+func srunEncodeInfo(info *srunInfo, token string) (string, error) {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(info); err != nil {
+		return "", err
+	}
+
+	encoded := srunXEncode(bytes.TrimRight(buf.Bytes(), "\n"), []byte(token))
+	return "{SRBX1}" + srunBase64.EncodeToString(encoded), nil
+}
+
+// srunXEncode 对应门户 js 中的 xEncode，是一个变形的 XXTEA
+func srunXEncode(msg []byte, key []byte) []byte {
+	if len(msg) == 0 {
+		return nil
+	}
+
+	v := srunToWords(msg, true)
+	k := srunToWords(key, false)
+	for len(k) < 4 {
+		k = append(k, 0)
+	}
+
+	n := uint32(len(v) - 1)
+	z := v[n]
+	var y, m, e, d uint32
+	for q := 6 + 52/(n+1); q > 0; q-- {
+		d += 0x9E3779B9
+		e = d >> 2 & 3
+		var p uint32
+		for p = 0; p < n; p++ {
+			y = v[p+1]
+			m = z>>5 ^ y<<2
+			m += (y>>3 ^ z<<4) ^ (d ^ y)
+			m += k[(p&3)^e] ^ z
+			v[p] += m
+			z = v[p]
+		}
+		y = v[0]
+		m = z>>5 ^ y<<2
+		m += (y>>3 ^ z<<4) ^ (d ^ y)
+		m += k[(p&3)^e] ^ z
+		v[n] += m
+		z = v[n]
+	}
+
+	out := make([]byte, len(v)*4)
+	for i, w := range v {
+		out[i*4] = byte(w)
+		out[i*4+1] = byte(w >> 8)
+		out[i*4+2] = byte(w >> 16)
+		out[i*4+3] = byte(w >> 24)
+	}
+	return out
+}
+
+func srunToWords(data []byte, withLength bool) []uint32 {
+	words := make([]uint32, (len(data)+3)/4)
+	for i, b := range data {
+		words[i>>2] |= uint32(b) << (8 * (i & 3))
+	}
+	if withLength {
+		words = append(words, uint32(len(data)))
+	}
+	return words
+}
+
+// srun3000EncodePassword 为旧版 srun3000 门户的密码混淆
+func srun3000EncodePassword(password string) string {
+	const key = "1234567890"
+	out := make([]byte, 0, len(password)*2)
+	for i := 0; i < len(password); i++ {
+		ki := password[i] ^ key[len(key)-i%len(key)-1]
+		low := (ki & 0x0f) + 0x36
+		high := (ki>>4)&0x0f + 0x63
+		if i%2 == 0 {
+			out = append(out, low, high)
+		} else {
+			out = append(out, high, low)
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// CurrentSSID 返回网卡当前连接的无线网络名称，未连接无线网络时返回空字符串。
+// iFace 为空时使用系统默认的无线网卡
+func CurrentSSID(iFace string) (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		out, err := exec.Command("netsh", "wlan", "show", "interfaces").Output()
+		if err != nil {
+			return "", err
+		}
+		return parseSSIDOutput(out, iFace, []string{"Name", "名称"}, "SSID"), nil
+	case "darwin":
+		if iFace == "" {
+			iFace = "en0"
+		}
+		// macOS 14 之后 networksetup 在未授权定位时不再返回名称，ipconfig getsummary 仍然可用
+		if out, err := exec.Command("ipconfig", "getsummary", iFace).Output(); err == nil {
+			if ssid := parseSSIDOutput(out, "", nil, "SSID"); ssid != "" {
+				return ssid, nil
+			}
+		}
+		out, err := exec.Command("networksetup", "-getairportnetwork", iFace).Output()
+		if err != nil {
+			return "", err
+		}
+		_, ssid, found := strings.Cut(strings.TrimSpace(string(out)), "Current Wi-Fi Network: ")
+		if !found {
+			return "", nil
+		}
+		return ssid, nil
+	default:
+		args := []string{"-r"}
+		if iFace != "" {
+			args = append([]string{iFace}, args...)
+		}
+		if out, err := exec.Command("iwgetid", args...).Output(); err == nil {
+			return strings.TrimSpace(string(out)), nil
+		}
+		out, err := exec.Command("nmcli", "-t", "-f", "active,ssid", "dev", "wifi").Output()
+		if err != nil {
+			return "", errors.New("neither iwgetid nor nmcli is available")
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if ssid, ok := strings.CutPrefix(line, "yes:"); ok {
+				return strings.ReplaceAll(ssid, `\:`, ":"), nil
+			}
+		}
+		return "", nil
+	}
+}
+
+// parseSSIDOutput 解析 `键 : 值` 形式的输出。iFace 不为空时只取 nameKeys 中的名称为 iFace 的网卡那一段
+func parseSSIDOutput(out []byte, iFace string, nameKeys []string, ssidKey string) string {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	matched := iFace == "" || len(nameKeys) == 0
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch {
+		case slices.Contains(nameKeys, key):
+			matched = iFace == "" || strings.EqualFold(value, iFace)
+		case key == ssidKey && matched:
+			return value
+		}
+	}
+	return ""
+}
+
+// onCampus 返回当前是否连接在 ssids 配置的校园网上，未配置 ssids 时总是返回 true
+func (c *Client) onCampus() bool {
+	return len(c.Config.SSIDs) == 0 || !c.Status().OffCampus
+}
+
+// pollSSID 检查当前连接的无线网络。连上配置的校园网时立即检测认证，离开时停止保活和检测，
+// 避免在家里或其他网络上不停地发送检测请求
+func (c *Client) pollSSID() {
+	ssid, err := CurrentSSID(c.Config.BindInterface)
+	if err != nil && c.ssidErr == nil {
+		c.Log.Printf(T("read wifi ssid error: %v"), err)
+	}
+	c.ssidErr = err
+
+	s := c.Status()
+	offCampus := !slices.Contains(c.Config.SSIDs, ssid)
+	if ssid == s.SSID && offCampus == s.OffCampus && c.ssidPolled {
+		return
+	}
+	c.ssidPolled = true
+	c.setSSID(ssid, offCampus)
+
+	if offCampus {
+		if ssid == "" {
+			c.Log.Println(T("not connected to wifi, detection paused"))
+		} else {
+			c.Log.Printf(T("wifi %q is not a campus network, detection paused"), ssid)
+		}
+		c.stopHeartbeat()
+		c.goOffline("left campus network")
+		return
+	}
+	c.Log.Printf(T("connected to campus wifi %q, checking now"), ssid)
+	c.RunCheck()
+}
+
+func (c *Client) setSSID(ssid string, offCampus bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.SSID = ssid
+	c.status.OffCampus = offCampus
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// stateFile 按账号保存运行中需要跨重启保留的状态，放在配置文件旁边，只通过 loadState/updateState 读写
+const stateFile = "state.json"
+
+// 旧版本分别保存ClientID和AlgoID的文件，stateFile 不存在时从中迁移
+const (
+	legacyClientIDFile = "client_id.json"
+	legacyAlgoIDFile   = "algo_id.json"
+)
+
+// AccountState 是一个账号保存的状态
+type AccountState struct {
+	ClientID string `json:"client_id,omitempty"`
+	AlgoID   string `json:"algo_id,omitempty"`
+	// Session 是天翼校园门户上次登录成功的会话，下线后清除。程序崩溃或被杀死时留在这里，
+	// 重启后门户提示已在线或设备数已满时用它下线残留的会话
+	Session *esurfingSession `json:"session,omitempty"`
+}
+
+// stateMu 保护 stateFile 和 fingerprint_file 的读写，所有账号共用这两个文件
+var stateMu sync.Mutex
+
+func statePath() string {
+	return filepath.Join(filepath.Dir(configFilePath), stateFile)
+}
+
+// readStates 读取所有账号的状态，调用者需持有 stateMu
+func readStates() (map[string]*AccountState, error) {
+	data, err := os.ReadFile(statePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return readLegacyStates(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[string]*AccountState{}
+	if err = json.Unmarshal(data, &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// readLegacyStates 读取旧版本的 client_id.json 和 algo_id.json，下一次 updateState 时合并写入 stateFile
+func readLegacyStates() map[string]*AccountState {
+	states := map[string]*AccountState{}
+	account := func(username string) *AccountState {
+		if states[username] == nil {
+			states[username] = &AccountState{}
+		}
+		return states[username]
+	}
+
+	dir := filepath.Dir(configFilePath)
+	for _, name := range []string{legacyClientIDFile, legacyAlgoIDFile} {
+		values := map[string]string{}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || json.Unmarshal(data, &values) != nil {
+			continue
+		}
+		for username, value := range values {
+			if name == legacyClientIDFile {
+				account(username).ClientID = value
+			} else {
+				account(username).AlgoID = value
+			}
+		}
+	}
+	return states
+}
+
+// loadState 返回当前账号保存的状态，文件不存在或损坏时返回空的状态
+func (c *Client) loadState() AccountState {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	states, err := readStates()
+	if err != nil {
+		c.Log.Printf(T("read %s error: %v"), statePath(), err)
+	}
+	if s := states[c.username()]; s != nil {
+		return *s
+	}
+	return AccountState{}
+}
+
+// updateState 修改当前账号的状态并写回文件，其他账号的状态保持不变。
+// 文件损坏时返回错误而不是覆盖，避免丢掉其他账号的ClientID
+func (c *Client) updateState(update func(s *AccountState)) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	states, err := readStates()
+	if err != nil {
+		return err
+	}
+	s := states[c.username()]
+	if s == nil {
+		s = &AccountState{}
+		states[c.username()] = s
+	}
+	update(s)
+
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，写到一半时断电或被杀死不会留下损坏的文件，丢掉所有账号的状态
+	tmp, err := os.CreateTemp(filepath.Dir(statePath()), ".state-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func(name string) {
+		_ = os.Remove(name)
+	}(tmp.Name())
+
+	if _, err = tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), statePath())
+}
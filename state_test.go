@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStateMigratesLegacyFiles(t *testing.T) {
+	c := newTestClient(t, &Config{Username: "alice"})
+	dir := filepath.Dir(configFilePath)
+	writeFile(t, filepath.Join(dir, legacyClientIDFile), `{"alice":"0b2f6a4e-9d1c-4c57-8a53-0e5d2f4c1a9b","bob":"6f1d2c3b-4a59-4e8f-9b7a-2c1d0e9f8a7b"}`)
+	writeFile(t, filepath.Join(dir, legacyAlgoIDFile), `{"alice":"`+AlgoAesCbc+`"}`)
+
+	if got := c.StableClientID().String(); got != "0b2f6a4e-9d1c-4c57-8a53-0e5d2f4c1a9b" {
+		t.Fatalf("StableClientID() = %s, want the legacy value", got)
+	}
+	if err := c.updateState(func(s *AccountState) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(statePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"6f1d2c3b-4a59-4e8f-9b7a-2c1d0e9f8a7b", AlgoAesCbc} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s = %s, missing %s", stateFile, data, want)
+		}
+	}
+}
+
+func TestUpdateStateKeepsOtherAccounts(t *testing.T) {
+	c := newTestClient(t, &Config{Username: "alice"})
+	writeFile(t, statePath(), `{"bob":{"client_id":"6f1d2c3b-4a59-4e8f-9b7a-2c1d0e9f8a7b"}}`)
+
+	id := c.StableClientID()
+	if err := c.updateState(func(s *AccountState) { s.AlgoID = AlgoAesCbc }); err != nil {
+		t.Fatal(err)
+	}
+	s := c.loadState()
+	if s.ClientID != id.String() || s.AlgoID != AlgoAesCbc {
+		t.Errorf("loadState() = %+v", s)
+	}
+	if data, _ := os.ReadFile(statePath()); !strings.Contains(string(data), "6f1d2c3b") {
+		t.Errorf("other account lost: %s", data)
+	}
+}
+
+func TestUpdateStateRefusesCorruptFile(t *testing.T) {
+	c := newTestClient(t, &Config{})
+	writeFile(t, statePath(), "{not json")
+
+	if err := c.updateState(func(s *AccountState) { s.AlgoID = AlgoAesCbc }); err == nil {
+		t.Fatal("updateState on a corrupt file succeeded")
+	}
+	if data, _ := os.ReadFile(statePath()); string(data) != "{not json" {
+		t.Errorf("corrupt file overwritten: %s", data)
+	}
+}
+
+func TestUpdateStateReplacesFile(t *testing.T) {
+	c := newTestClient(t, &Config{})
+	writeFile(t, statePath(), `{}`)
+	// 硬链接在原地写入时会跟着变，替换文件时保持旧内容
+	link := filepath.Join(t.TempDir(), "link.json")
+	if err := os.Link(statePath(), link); err != nil {
+		t.Skip(err)
+	}
+
+	if err := c.updateState(func(s *AccountState) { s.AlgoID = AlgoAesCbc }); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(link); string(data) != `{}` {
+		t.Errorf("%s written in place: %s", stateFile, data)
+	}
+	if c.loadState().AlgoID != AlgoAesCbc {
+		t.Errorf("loadState() = %+v", c.loadState())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(statePath()))
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("temporary file %s left behind", entry.Name())
+		}
+	}
+}
+
+func TestAlgoIDRejected(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("%w: data Error", ErrAlgoIDRejected), true},
+		{fmt.Errorf("%w: bad padding", ErrDecryptResponse), true},
+		{&PortalError{Code: "E001", Message: "algo not supported"}, true},
+		{errors.New("unexpected status code: 503"), false},
+		{&timeoutError{}, false},
+	}
+	for _, test := range tests {
+		if got := algoIDRejected(test.err); got != test.want {
+			t.Errorf("algoIDRejected(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestNegotiateTicketKeepsAlgoIDOnServerError(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	e := NewESurfing(newTestClient(t, &Config{}))
+	e.TicketUrl = server.URL + "/ticket"
+	if err := e.negotiateTicket(); err == nil || algoIDRejected(err) {
+		t.Fatalf("negotiateTicket() = %v, want a non-rejection error", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d requests, want 1: a 503 must not rotate the AlgoID", n)
+	}
+	if id := e.loadAlgoID(); id != "" {
+		t.Errorf("saved algo id %q after a failure", id)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
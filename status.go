@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ClientStatus 是客户端当前状态的快照，供控制接口等其他 goroutine 读取
+type ClientStatus struct {
+	Username  string    `json:"username"`
+	Interface string    `json:"interface"`
+	Portal    string    `json:"portal"`
+	Online    bool      `json:"online"`
+	Paused    bool      `json:"paused"`
+	Idle      bool      `json:"idle"`
+	UserIP    string    `json:"user_ip"`
+	AuthTime  time.Time `json:"auth_time"`
+	LastError string    `json:"last_error"`
+
+	HeartbeatInterval time.Duration `json:"-"`
+	NextHeartbeat     time.Time     `json:"next_heartbeat"`
+	LastHeartbeat     time.Time     `json:"last_heartbeat"`
+	HeartbeatOK       bool          `json:"heartbeat_ok"`
+	LoopTime          time.Time     `json:"loop_time"`
+	MaintenanceUntil  time.Time     `json:"maintenance_until,omitzero"`
+	IdleInterface     string        `json:"-"`
+	SSID              string        `json:"ssid,omitempty"`
+	OffCampus         bool          `json:"off_campus,omitempty"`
+	Profile           string        `json:"profile,omitempty"`
+	CircuitOpen       bool          `json:"circuit_open,omitempty"`
+
+	AuthCount         int `json:"auth_count"`
+	AuthFailures      int `json:"auth_failures"`
+	HeartbeatCount    int `json:"heartbeat_count"`
+	HeartbeatFailures int `json:"heartbeat_failures"`
+
+	SessionRxBytes uint64 `json:"session_rx_bytes"`
+	SessionTxBytes uint64 `json:"session_tx_bytes"`
+}
+
+func (c *Client) markLoop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.LoopTime = time.Now()
+}
+
+// Ready 在已认证且最近一次心跳成功时返回空字符串，否则返回原因
+func (s ClientStatus) Ready() string {
+	switch {
+	case s.Paused:
+		return "paused"
+	case s.Idle:
+		return "logged out while idle"
+	case s.OffCampus:
+		return "not on a campus network"
+	case time.Now().Before(s.MaintenanceUntil):
+		return "portal under maintenance"
+	case s.CircuitOpen:
+		return "portal circuit open"
+	case !s.Online:
+		return "not authenticated"
+	case !s.HeartbeatOK:
+		return "last heartbeat failed"
+	}
+	return ""
+}
+
+// Alive 判断主循环是否仍在按检测间隔运转
+func (c *Client) Alive() bool {
+	s := c.Status()
+	limit := 3*time.Millisecond*time.Duration(c.Config.CheckInterval) + time.Minute
+	return !s.LoopTime.IsZero() && time.Since(s.LoopTime) < limit
+}
+
+type statusFileEntry struct {
+	ClientStatus
+	HeartbeatInterval int `json:"heartbeat_interval"`
+}
+
+var statusFilePath string
+var statusFileMu sync.Mutex
+
+// statusSnapshot 返回状态文件和 /status 接口输出的内容，username 为空时包括所有账号
+func statusSnapshot(username string) map[string]any {
+	entries := make([]statusFileEntry, 0)
+	for _, c := range SelectClients(username) {
+		status := c.Status()
+		entries = append(entries, statusFileEntry{
+			ClientStatus:      status,
+			HeartbeatInterval: int(status.HeartbeatInterval / time.Second),
+		})
+	}
+	return map[string]any{
+		"updated_at": time.Now(),
+		"clients":    entries,
+	}
+}
+
+// WriteStatusFile 把所有账号的状态以JSON写入状态文件，先写临时文件再重命名，读取方不会读到写了一半的内容
+func WriteStatusFile() error {
+	if statusFilePath == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(statusSnapshot(""), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	statusFileMu.Lock()
+	defer statusFileMu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(statusFilePath), ".status-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func(name string) {
+		_ = os.Remove(name)
+	}(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), statusFilePath)
+}
+
+func (c *Client) Status() ClientStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+func (c *Client) setOnline(online bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.Online = online
+	if !online {
+		c.session = nil
+	}
+}
+
+func (c *Client) setAuthenticated() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.Online = true
+	c.status.UserIP = c.UserIP
+	c.status.AuthTime = time.Now()
+	c.status.LastError = ""
+	c.status.HeartbeatOK = true
+	c.status.AuthCount++
+	c.session = c.snapshotSession()
+	if c.session != nil {
+		RegisterSecret(c.session.Ticket, c.session.ClientID)
+	}
+}
+
+func (c *Client) recordAuthFailure(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.LastError = RedactError(err)
+	c.status.AuthFailures++
+}
+
+func (c *Client) heartbeatTicked() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.NextHeartbeat = time.Now().Add(c.status.HeartbeatInterval)
+}
+
+func (c *Client) recordHeartbeat(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.status.LastError = RedactError(err)
+		c.status.HeartbeatFailures++
+		c.status.HeartbeatOK = false
+		return
+	}
+	c.status.LastHeartbeat = time.Now()
+	c.status.HeartbeatCount++
+	c.status.HeartbeatOK = true
+}
+
+func (c *Client) setError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.LastError = RedactError(err)
+}
+
+func (c *Client) setPaused(paused bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.Paused = paused
+}
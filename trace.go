@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+var traceHTTP bool
+
+const redactedValue = "******"
+
+// 这些请求参数和请求头会在追踪日志中被打码
+var (
+	sensitiveParams  = []string{"password", "userpwd", "pwd", "passwd", "ticket", "chksum", "info", "sign", "token"}
+	sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+)
+
+// traceRequest 记录请求行、请求头以及表单内容
+func (c *Client) traceRequest(request *http.Request) {
+	log := c.Log
+	log.Printf("> %s %s %s", request.Method, RedactURL(request.URL), request.Proto)
+	traceHeaders(c, ">", request.Header)
+
+	if request.GetBody == nil || !strings.HasPrefix(request.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if request.ContentLength > 0 {
+			log.Printf("> [%d bytes body]", request.ContentLength)
+		}
+		return
+	}
+
+	body, err := request.GetBody()
+	if err != nil {
+		return
+	}
+	data, _ := io.ReadAll(io.LimitReader(body, 4096))
+	_ = body.Close()
+
+	form, err := url.ParseQuery(string(data))
+	if err != nil {
+		log.Printf("> [%d bytes body]", len(data))
+		return
+	}
+	log.Println(">", redactValues(form).Encode())
+}
+
+func (c *Client) traceResponse(request *http.Request, response *http.Response, err error, elapsed time.Duration) {
+	log := c.Log
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		log.Printf("< %s %s error after %v: %v", request.Method, RedactURL(request.URL), elapsed, err)
+		return
+	}
+
+	log.Printf("< %s %s (%v)", response.Proto, response.Status, elapsed)
+	traceHeaders(c, "<", response.Header)
+}
+
+func traceHeaders(c *Client, prefix string, header http.Header) {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		value := strings.Join(header[k], ", ")
+		for _, s := range sensitiveHeaders {
+			if strings.EqualFold(k, s) && !unsafeDebug {
+				value = redactedValue
+			}
+		}
+		if strings.EqualFold(k, "Location") {
+			if parsed, err := url.Parse(value); err == nil {
+				value = RedactURL(parsed)
+			}
+		}
+		c.Log.Printf("%s %s: %s", prefix, k, value)
+	}
+}
+
+// RedactURL 返回将敏感参数打码后的地址
+func RedactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.String()
+	}
+	redacted := *u
+	redacted.RawQuery = redactValues(u.Query()).Encode()
+	return redacted.String()
+}
+
+func redactValues(values url.Values) url.Values {
+	if unsafeDebug {
+		return values
+	}
+	out := url.Values{}
+	for k, v := range values {
+		if isSensitiveParam(k) {
+			out[k] = []string{redactedValue}
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func isSensitiveParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range sensitiveParams {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
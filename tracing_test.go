@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTracerExportRedacts(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer server.Close()
+
+	tr := &Tracer{Endpoint: server.URL, client: server.Client()}
+	span := &Span{
+		Name:  "auth",
+		Start: time.Now(),
+		End:   time.Now(),
+		Attrs: map[string]string{"url": "http://10.0.0.1/auth?ticket=T-attr-raw"},
+		Err:   errors.New("post http://10.0.0.1/login?userpwd=hunter22: timeout"),
+	}
+	if err := tr.export([]*Span{span}); err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"T-attr-raw", "hunter22"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("exported spans leak %q: %s", secret, body)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// trafficBase 记录上一次读取的网卡累计收发字节数，本次会话的流量按两次读取的差值累加
+type trafficBase struct {
+	iFace string
+	rx    uint64
+	tx    uint64
+}
+
+// trafficInterface 返回统计流量的网卡：绑定的网卡，或持有默认路由的网卡
+func (c *Client) trafficInterface() string {
+	if c.Config.BindIP != "" {
+		name, _ := interfaceByIP(net.ParseIP(c.Config.BindIP))
+		return name
+	}
+	if c.Config.BindInterface != "" {
+		return c.Config.BindInterface
+	}
+	name, _ := DefaultRouteInterface()
+	return name
+}
+
+// startTrafficSession 在认证成功时记录网卡当前的计数，作为本次会话的起点
+func (c *Client) startTrafficSession() {
+	c.traffic = nil
+	iFace := c.trafficInterface()
+	if iFace == "" {
+		return
+	}
+	rx, tx, err := InterfaceCounters(iFace)
+	if err != nil {
+		return
+	}
+	c.traffic = &trafficBase{iFace: iFace, rx: rx, tx: tx}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.SessionRxBytes = 0
+	c.status.SessionTxBytes = 0
+}
+
+// updateTraffic 刷新状态中本次会话的收发字节数。网卡计数被重置(如接口重建)时从新的计数继续累加
+func (c *Client) updateTraffic() {
+	if c.traffic == nil {
+		return
+	}
+	rx, tx, err := InterfaceCounters(c.traffic.iFace)
+	if err != nil {
+		return
+	}
+
+	delta := func(current uint64, last uint64) uint64 {
+		if current < last {
+			return current
+		}
+		return current - last
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.SessionRxBytes += delta(rx, c.traffic.rx)
+	c.status.SessionTxBytes += delta(tx, c.traffic.tx)
+	c.traffic.rx, c.traffic.tx = rx, tx
+}
+
+// endTrafficSession 结束本次会话的统计并在日志中输出总流量
+func (c *Client) endTrafficSession() {
+	if c.traffic == nil {
+		return
+	}
+	c.updateTraffic()
+	c.traffic = nil
+
+	s := c.Status()
+	c.Log.Printf(T("session traffic: received %s, sent %s"), formatBytes(s.SessionRxBytes), formatBytes(s.SessionTxBytes))
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,29 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// InterfaceCounters 从 /sys/class/net 读取网卡累计的收发字节数
+func InterfaceCounters(interfaceName string) (rx uint64, tx uint64, err error) {
+	read := func(name string) (uint64, error) {
+		data, err := os.ReadFile(filepath.Join("/sys/class/net", interfaceName, "statistics", name))
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	}
+
+	if rx, err = read("rx_bytes"); err != nil {
+		return 0, 0, err
+	}
+	if tx, err = read("tx_bytes"); err != nil {
+		return 0, 0, err
+	}
+	return rx, tx, nil
+}
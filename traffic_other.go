@@ -0,0 +1,40 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// InterfaceCounters 通过 netstat -ibn 读取网卡累计的收发字节数，目前只支持 macOS/BSD
+func InterfaceCounters(interfaceName string) (rx uint64, tx uint64, err error) {
+	if runtime.GOOS == "windows" {
+		return 0, 0, errors.New("traffic accounting is not supported on windows")
+	}
+
+	out, err := exec.Command("netstat", "-ibn").Output()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Name Mtu Network Address Ipkts Ierrs Ibytes Opkts Oerrs Obytes Coll，
+	// 每个网卡的第一行是链路层地址，统计值在该行
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 11 || fields[0] != interfaceName || !strings.HasPrefix(fields[2], "<Link#") {
+			continue
+		}
+		if rx, err = strconv.ParseUint(fields[6], 10, 64); err != nil {
+			return 0, 0, err
+		}
+		if tx, err = strconv.ParseUint(fields[9], 10, 64); err != nil {
+			return 0, 0, err
+		}
+		return rx, tx, nil
+	}
+	return 0, 0, errors.New("interface not found in netstat: " + interfaceName)
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// TranscriptEntry 是录制下来的一次HTTP交互，每行一个JSON对象保存在录制文件中
+type TranscriptEntry struct {
+	Time           time.Time   `json:"time"`
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	RequestHeader  http.Header `json:"request_header,omitempty"`
+	RequestBody    string      `json:"request_body,omitempty"`
+	Status         int         `json:"status,omitempty"`
+	ResponseHeader http.Header `json:"response_header,omitempty"`
+	ResponseBody   string      `json:"response_body,omitempty"`
+	BodyBase64     bool        `json:"body_base64,omitempty"`
+	Error          string      `json:"error,omitempty"`
+
+	// AlgoID 是请求头中的 Algo-ID。天翼校园的报文用固定密钥加密，打码前必须先解密，
+	// RequestDecrypted/ResponseDecrypted 表示对应的报文保存的是解密并打码后的明文，回放时按 AlgoID 重新加密
+	AlgoID            string `json:"algo_id,omitempty"`
+	RequestDecrypted  bool   `json:"request_decrypted,omitempty"`
+	ResponseDecrypted bool   `json:"response_decrypted,omitempty"`
+}
+
+func (e *TranscriptEntry) body() ([]byte, error) {
+	if e.BodyBase64 {
+		return base64.StdEncoding.DecodeString(e.ResponseBody)
+	}
+	if e.ResponseDecrypted {
+		c := NewCipher(e.AlgoID)
+		if c == nil {
+			return nil, errors.New("Unknown AlgoID:" + e.AlgoID)
+		}
+		return c.Encrypt([]byte(e.ResponseBody))
+	}
+	return []byte(e.ResponseBody), nil
+}
+
+// TranscriptRecorder 把所有账号与门户之间的HTTP交互追加写入同一个文件。
+// 加密的报文先解密，所有地址、请求头和报文都经过 Redact 打码后才写入
+type TranscriptRecorder struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+var recorder *TranscriptRecorder
+
+func StartRecorder(path string) (*TranscriptRecorder, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open transcript: %v", err)
+	}
+	return &TranscriptRecorder{file: file}, nil
+}
+
+func (r *TranscriptRecorder) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.file.Close()
+}
+
+func (r *TranscriptRecorder) write(entry *TranscriptEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = r.file.Write(append(data, '\n'))
+}
+
+// Transport 返回记录经过 next 的每个请求的 RoundTripper
+func (r *TranscriptRecorder) Transport(next http.RoundTripper) http.RoundTripper {
+	return &recordingTransport{recorder: r, next: next}
+}
+
+type recordingTransport struct {
+	recorder *TranscriptRecorder
+	next     http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	entry := &TranscriptEntry{
+		Time:          time.Now(),
+		Method:        request.Method,
+		URL:           RedactURL(request.URL),
+		RequestHeader: redactHeader(request.Header),
+		AlgoID:        request.Header.Get("Algo-ID"),
+	}
+	c := NewCipher(entry.AlgoID)
+	entry.RequestBody, entry.RequestDecrypted = recordRequestBody(request, c)
+
+	response, err := t.next.RoundTrip(request)
+	if err != nil {
+		entry.Error = RedactError(err)
+		t.recorder.write(entry)
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxResponseSize+1))
+	_ = response.Body.Close()
+	if len(data) > maxResponseSize {
+		entry.Error = ErrResponseTooLarge.Error()
+		t.recorder.write(entry)
+		return nil, ErrResponseTooLarge
+	}
+	response.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		entry.Error = RedactError(err)
+	}
+
+	entry.Status = response.StatusCode
+	entry.ResponseHeader = redactHeader(response.Header)
+	if plain, ok := decryptRecorded(c, data); ok {
+		entry.ResponseBody = Redact(plain)
+		entry.ResponseDecrypted = true
+	} else if utf8.Valid(data) {
+		entry.ResponseBody = Redact(string(data))
+	} else {
+		entry.ResponseBody = base64.StdEncoding.EncodeToString(data)
+		entry.BodyBase64 = true
+	}
+	t.recorder.write(entry)
+	return response, nil
+}
+
+// decryptRecorded 用请求的 Algo-ID 对应的算法解密报文，解密结果是XML或JSON时才认为报文是加密的。
+// 这些算法的密钥都是固定的，不解密直接保存的报文任何人都可以解开，等于没有打码
+func decryptRecorded(c Cipher, data []byte) (string, bool) {
+	if c == nil || len(data) == 0 {
+		return "", false
+	}
+	plain, err := decryptResponse(c, data)
+	if err != nil || !utf8.Valid(plain) {
+		return "", false
+	}
+	text := strings.TrimSpace(string(plain))
+	if !strings.HasPrefix(text, "<") && !strings.HasPrefix(text, "{") {
+		return "", false
+	}
+	return string(plain), true
+}
+
+// recordRequestBody 返回打码后的请求体，加密的请求体解密后再打码，第二个返回值表示保存的是解密后的明文
+func recordRequestBody(request *http.Request, c Cipher) (string, bool) {
+	if request.GetBody == nil {
+		return "", false
+	}
+	body, err := request.GetBody()
+	if err != nil {
+		return "", false
+	}
+	data, _ := io.ReadAll(body)
+	_ = body.Close()
+
+	if strings.HasPrefix(request.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(data)); err == nil {
+			return Redact(redactValues(form).Encode()), false
+		}
+	}
+	if plain, ok := decryptRecorded(c, data); ok {
+		return Redact(plain), true
+	}
+	if !utf8.Valid(data) {
+		return fmt.Sprintf("[%d bytes body]", len(data)), false
+	}
+	return Redact(string(data)), false
+}
+
+// redactHeader 复制请求头/响应头并打码：凭据类的请求头整体替换，其余的值(如 Client-ID、Location)经过 Redact
+func redactHeader(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	out := header.Clone()
+	for _, values := range out {
+		for i, value := range values {
+			values[i] = Redact(value)
+		}
+	}
+	for _, name := range sensitiveHeaders {
+		if out.Get(name) != "" {
+			out.Set(name, redactedValue)
+		}
+	}
+	if location := out.Get("Location"); location != "" {
+		if parsed, err := url.Parse(location); err == nil {
+			out.Set("Location", RedactURL(parsed))
+		}
+	}
+	return out
+}
+
+// TranscriptReplayer 按录制顺序回放响应，代替真实网络，用于复现某个学校门户的完整认证流程
+type TranscriptReplayer struct {
+	mu      sync.Mutex
+	entries []*TranscriptEntry
+	used    []bool
+}
+
+var replayer *TranscriptReplayer
+
+// ErrTranscriptExhausted 表示请求在录制文件中找不到尚未回放的对应记录
+var ErrTranscriptExhausted = errors.New("no recorded response left for request")
+
+func LoadTranscript(path string) (*TranscriptReplayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open transcript: %v", err)
+	}
+	defer file.Close()
+
+	r := &TranscriptReplayer{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		entry := &TranscriptEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("transcript line %d: %v", line, err)
+		}
+		r.entries = append(r.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read transcript: %v", err)
+	}
+	r.used = make([]bool, len(r.entries))
+	return r, nil
+}
+
+// RoundTrip 返回与请求方法和路径相同、且尚未回放过的第一条记录，主机名不参与匹配
+func (r *TranscriptReplayer) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil {
+		_ = request.Body.Close()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, entry := range r.entries {
+		if r.used[i] || entry.Method != request.Method || !samePath(entry.URL, request.URL) {
+			continue
+		}
+		r.used[i] = true
+
+		if entry.Error != "" && entry.Status == 0 {
+			return nil, errors.New(entry.Error)
+		}
+		data, err := entry.body()
+		if err != nil {
+			return nil, fmt.Errorf("transcript body: %v", err)
+		}
+		header := entry.ResponseHeader.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status)),
+			StatusCode:    entry.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(data)),
+			ContentLength: int64(len(data)),
+			Request:       request,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrTranscriptExhausted, request.Method, RedactURL(request.URL))
+}
+
+// Remaining 返回尚未回放的记录数
+func (r *TranscriptReplayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, used := range r.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+func samePath(recorded string, u *url.URL) bool {
+	parsed, err := url.Parse(recorded)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSuffix(parsed.Path, "/") == strings.TrimSuffix(u.Path, "/")
+}
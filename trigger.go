@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// triggerEvents 是DHCP客户端和NetworkManager dispatcher中表示地址已获得或变化的事件，其余事件忽略
+var triggerEvents = []string{
+	"bound", "renew", "rebind", "reboot", "bound6", "renew6", "rebind6", "reboot6", // dhclient(大写)、udhcpc
+	"up", "dhcp4-change", "dhcp6-change", "connectivity-change", // NetworkManager dispatcher
+}
+
+// RunTrigger 实现 `trigger [interface] [event]`，通知运行中的进程网络已变化，立即重新检测而不必等待下一轮。
+// 可以直接在DHCP钩子中调用：未传入参数时从 dhclient 设置的 $interface 和 $reason 中读取
+func RunTrigger(args []string) error {
+	if controlSocketPath == "" {
+		return errors.New("trigger requires -control of the running process")
+	}
+
+	var iFace, event string
+	if len(args) > 0 {
+		iFace = args[0]
+	} else {
+		iFace = os.Getenv("interface")
+	}
+	if len(args) > 1 {
+		event = args[1]
+	} else {
+		event = os.Getenv("reason")
+	}
+
+	if event != "" && !slices.Contains(triggerEvents, strings.ToLower(event)) {
+		return nil
+	}
+
+	reply, err := SendControlCommand(controlSocketPath, strings.TrimSpace(CommandCheck+" "+iFace))
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(reply, "error:") {
+		return errors.New(strings.TrimSpace(strings.TrimPrefix(reply, "error:")))
+	}
+	fmt.Print(reply)
+	return nil
+}
+
+// checkTargets 返回网络变化时需要重新检测的账号：绑定了该网卡的账号，没有时(如走默认路由的账号)为全部账号
+func checkTargets(target string) []*Client {
+	if selected := SelectClients(target); len(selected) > 0 {
+		return selected
+	}
+	return SelectClients("")
+}
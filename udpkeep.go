@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UDPHeartbeatConfig 是与 HTTP 保活并行发送的 UDP 保活包。address 和 payload 中的
+// {user_ip} {ac_ip} {username} {client_id} {mac} {ticket} {time} 会替换为当前会话的值
+type UDPHeartbeatConfig struct {
+	Address  string `json:"address"`
+	Payload  string `json:"payload"`
+	Encoding string `json:"encoding"`
+	Interval int    `json:"interval"`
+}
+
+const (
+	UDPPayloadText = "text"
+	UDPPayloadHex  = "hex"
+)
+
+func (u *UDPHeartbeatConfig) validate() error {
+	if u.Address == "" {
+		return errors.New("udp heartbeat address is empty")
+	}
+	switch u.Encoding {
+	case "":
+		u.Encoding = UDPPayloadText
+	case UDPPayloadText, UDPPayloadHex:
+	default:
+		return errors.New("unknown udp heartbeat encoding: " + u.Encoding)
+	}
+	if u.Interval <= 0 {
+		u.Interval = 30000
+	}
+	return nil
+}
+
+// expandSessionTemplate 用会话信息替换模板中的占位符
+func expandSessionTemplate(template string, s *Session) string {
+	return strings.NewReplacer(
+		"{user_ip}", s.UserIP,
+		"{ac_ip}", s.AcIP,
+		"{username}", s.Username,
+		"{client_id}", s.ClientID,
+		"{mac}", s.MacAddress,
+		"{ticket}", s.Ticket,
+		"{time}", strconv.FormatInt(time.Now().Unix(), 10),
+	).Replace(template)
+}
+
+// runUDPHeartbeat 在已认证期间按间隔发送 UDP 保活包，发送失败只记录日志，不影响 HTTP 保活
+func (c *Client) runUDPHeartbeat() {
+	cfg := c.Config.UDPHeartbeat
+	ticker := time.NewTicker(time.Millisecond * time.Duration(cfg.Interval))
+	defer ticker.Stop()
+
+	failing := false
+	for {
+		select {
+		case <-c.Ctx.Done():
+			return
+		case <-ticker.C:
+			session := c.Session()
+			if session == nil {
+				continue
+			}
+			err := c.sendUDPHeartbeat(cfg, session)
+			if err != nil && !failing {
+				c.Log.Printf(T("send udp heartbeat error: %v"), err)
+			}
+			failing = err != nil
+		}
+	}
+}
+
+func (c *Client) sendUDPHeartbeat(cfg *UDPHeartbeatConfig, s *Session) error {
+	payload := []byte(expandSessionTemplate(cfg.Payload, s))
+	if cfg.Encoding == UDPPayloadHex {
+		decoded, err := hex.DecodeString(strings.ReplaceAll(string(payload), " ", ""))
+		if err != nil {
+			return err
+		}
+		payload = decoded
+	}
+
+	control, _ := bindControl(c.Config)
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: control}
+	if ip, err := BindLocalIP(c.Config); err == nil && ip != nil {
+		dialer.LocalAddr = &net.UDPAddr{IP: ip}
+	}
+
+	conn, err := dialer.DialContext(c.Ctx, "udp", expandSessionTemplate(cfg.Address, s))
+	if err != nil {
+		return err
+	}
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	_, err = conn.Write(payload)
+	return err
+}
@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"math/rand/v2"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -52,6 +58,76 @@ func GetInterfaceIP(interfaceName string) (string, error) {
 	return "", fmt.Errorf("no available ipv4 address at interface %s", interfaceName)
 }
 
+// InterfaceDefault 表示使用持有默认路由的网卡
+const InterfaceDefault = "default"
+
+// ResolveInterface 将 bind_interface 的取值解析为网卡名称，支持网卡名、
+// default(默认路由所在网卡)、网段(如 10.0.0.0/8)以及通配符(如 eth*)
+func ResolveInterface(spec string) (string, error) {
+	return resolveInterface(spec, nil)
+}
+
+// resolveInterface 按条件选择网卡时跳过已被其他账号占用的网卡
+func resolveInterface(spec string, claimed map[string]string) (string, error) {
+	switch {
+	case spec == "":
+		return "", nil
+	case spec == InterfaceDefault:
+		return DefaultRouteInterface()
+	case strings.Contains(spec, "/"):
+		_, subnet, err := net.ParseCIDR(spec)
+		if err != nil {
+			return "", fmt.Errorf("invalid interface subnet %s: %v", spec, err)
+		}
+		return findInterface(spec, func(iFace net.Interface, ip net.IP) bool {
+			return claimed[iFace.Name] == "" && subnet.Contains(ip)
+		})
+	case strings.ContainsAny(spec, "*?["):
+		if _, err := path.Match(spec, ""); err != nil {
+			return "", fmt.Errorf("invalid interface pattern %s: %v", spec, err)
+		}
+		return findInterface(spec, func(iFace net.Interface, ip net.IP) bool {
+			matched, _ := path.Match(spec, iFace.Name)
+			return matched && claimed[iFace.Name] == ""
+		})
+	}
+	return spec, nil
+}
+
+// findInterface 返回第一个已启用、有IPv4地址且满足条件的网卡
+func findInterface(spec string, match func(iFace net.Interface, ip net.IP) bool) (string, error) {
+	iFaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+
+	for _, iFace := range iFaces {
+		if iFace.Flags&net.FlagUp == 0 || iFace.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addresses, err := iFace.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addresses {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil {
+				continue
+			}
+			if match(iFace, ipNet.IP) {
+				return iFace.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no interface matches %s", spec)
+}
+
+func interfaceByIP(ip net.IP) (string, error) {
+	return findInterface(ip.String(), func(iFace net.Interface, addr net.IP) bool {
+		return addr.Equal(ip)
+	})
+}
+
 const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
 func GenerateRandomString(length int) string {
@@ -113,6 +189,13 @@ const ConfigEndTag = "//config.campus.js.chinatelecom.com-->"
 
 func FormatEConfig(data []byte) ([]byte, error) {
 	str1 := strings.Split(string(data), ConfigStartTag)
+	if len(str1) < 2 {
+		// 有的固件直接返回配置 XML，不包在注释里
+		if !strings.Contains(str1[0], "<") {
+			return nil, errors.New("econfig not found in index page")
+		}
+		str1 = append(str1, str1[0])
+	}
 	str2 := strings.Split(str1[1], ConfigEndTag)
 
 	str3 := strings.ReplaceAll(str2[0], "&width=0", "")
@@ -121,42 +204,120 @@ func FormatEConfig(data []byte) ([]byte, error) {
 	return []byte(str4), nil
 }
 
-func NewHttpTransport(c *Config) (http.RoundTripper, error) {
+var portalRedirectPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)<meta[^>]+http-equiv\s*=\s*["']?refresh["']?[^>]+content\s*=\s*["']?\s*\d*\s*;?\s*url\s*=\s*([^"'>\s]+)`),
+	regexp.MustCompile(`(?i)<meta[^>]+content\s*=\s*["']?\s*\d*\s*;?\s*url\s*=\s*([^"'>\s]+)[^>]+http-equiv\s*=\s*["']?refresh`),
+	regexp.MustCompile(`(?i)(?:window|top|self|document|parent)(?:\.self)?\.location(?:\.href)?\s*=\s*["']([^"']+)["']`),
+	regexp.MustCompile(`(?i)location\.(?:replace|assign)\(\s*["']([^"']+)["']\s*\)`),
+	regexp.MustCompile(`(?i)\blocation\.href\s*=\s*["']([^"']+)["']`),
+}
+
+// ExtractPortalURL 从返回200的页面中提取 meta refresh 或 js 跳转的门户地址，都没有时使用WISPr消息中的登录地址
+func ExtractPortalURL(base *url.URL, body []byte) string {
+	for _, pattern := range portalRedirectPatterns {
+		match := pattern.FindSubmatch(body)
+		if match == nil {
+			continue
+		}
+
+		target := strings.ReplaceAll(string(match[1]), "&amp;", "&")
+		ref, err := url.Parse(target)
+		if err != nil {
+			continue
+		}
+		if base != nil {
+			ref = base.ResolveReference(ref)
+		}
+		return ref.String()
+	}
+	if message, err := ParseWISPr(body); err == nil && message.LoginURL != "" {
+		return message.LoginURL
+	}
+	return ""
+}
+
+// NewTLSConfig 为门户请求构造TLS配置，ca_file 中的证书追加到系统证书之后
+func NewTLSConfig(c *Config) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: c.TLSInsecureSkipVerify, ServerName: c.TLSServerName}
+	if c.CAFile == "" {
+		return config, nil
+	}
+
+	pem, err := os.ReadFile(c.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read ca file: %v", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificate found in ca file: " + c.CAFile)
+	}
+	config.RootCAs = pool
+	return config, nil
+}
+
+// BindLocalIP 返回配置要求绑定的本地源地址，未绑定时返回nil
+func BindLocalIP(c *Config) (net.IP, error) {
+	if c.BindIP != "" {
+		ip := net.ParseIP(c.BindIP)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid bind ip: %s", c.BindIP)
+		}
+		if _, err := interfaceByIP(ip); err != nil {
+			return nil, fmt.Errorf("bind ip %s is not configured on any interface", c.BindIP)
+		}
+		return ip, nil
+	}
+
 	if c.BindInterface != "" {
 		ip, err := GetInterfaceIP(c.BindInterface)
-		fmt.Println(c.BindInterface)
 		if err != nil {
 			return nil, errors.New(fmt.Errorf("failed to get interface IP: %w", err).Error())
 		}
-
-		localAddr := &net.TCPAddr{IP: net.ParseIP(ip)}
-		return &http.Transport{
-			DialContext: (&net.Dialer{
-				LocalAddr: localAddr,
-				Resolver:  GetResolver(c),
-			}).DialContext,
-		}, nil
-	} else {
-		return &http.Transport{
-			DialContext: (&net.Dialer{
-				Resolver: GetResolver(c),
-			}).DialContext,
-		}, nil
+		return net.ParseIP(ip), nil
 	}
+
+	return nil, nil
 }
 
-func GetResolver(c *Config) *net.Resolver {
-	if c.DnsAddress == "" {
-		return net.DefaultResolver
+func NewHttpTransport(c *Config) (http.RoundTripper, error) {
+	control, err := bindControl(c)
+	if err != nil {
+		return nil, err
 	}
 
-	return &net.Resolver{
-		PreferGo: true,
-		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-			d := net.Dialer{
-				Timeout: 5 * time.Second,
-			}
-			return d.DialContext(ctx, "udp", c.DnsAddress)
-		},
+	dialer := &net.Dialer{
+		Timeout:   time.Millisecond * time.Duration(c.ConnectTimeout),
+		KeepAlive: time.Millisecond * time.Duration(c.KeepAlive),
+		Resolver:  GetResolver(c),
+		Control:   control,
 	}
+
+	localIP, err := BindLocalIP(c)
+	if err != nil {
+		return nil, err
+	}
+	if localIP != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: localIP}
+	}
+
+	tlsConfig, err := NewTLSConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Transport{
+		TLSClientConfig: tlsConfig,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, staticHostAddress(c.Hosts, address))
+		},
+		DisableKeepAlives:   c.KeepAlive < 0,
+		MaxIdleConns:        c.MaxIdleConns,
+		MaxIdleConnsPerHost: c.MaxIdleConns,
+		IdleConnTimeout:     time.Millisecond * time.Duration(c.IdleConnTimeout),
+		TLSHandshakeTimeout: time.Millisecond * time.Duration(c.TLSHandshakeTimeout),
+	}, nil
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+// ValidateConfig 实现 `config validate` 子命令，检查配置文件中的所有账号并输出每一处错误，
+// 有错误时返回非nil，进程以非0退出
+func ValidateConfig(path string, out io.Writer) error {
+	if err := LoadConfig(path); err != nil {
+		return err
+	}
+
+	problems := 0
+	report := func(i int, c *Config, format string, a ...any) {
+		problems++
+		_, _ = fmt.Fprintf(out, "%s: account %d (%s): %s\n", path, i+1, c.Username, fmt.Sprintf(format, a...))
+	}
+
+	usernames := map[string]int{}
+	for i, c := range Configs {
+		if c == nil {
+			problems++
+			_, _ = fmt.Fprintf(out, "%s: account %d: empty entry\n", path, i+1)
+			continue
+		}
+
+		if c.Username == "" {
+			report(i, c, "username is empty")
+		} else if first, ok := usernames[c.Username]; ok {
+			report(i, c, "username is already used by account %d", first+1)
+		} else {
+			usernames[c.Username] = i
+		}
+		if c.Password == "" {
+			report(i, c, "password is empty")
+		}
+
+		for j, nc := range c.Notifiers {
+			if _, err := NewNotifier(nc); err != nil {
+				report(i, c, "notifiers[%d]: %v", j, err)
+			}
+		}
+
+		// 只检查配置，不创建日志文件和目录
+		check := *c
+		check.Notifiers = nil
+		check.LogFile = ""
+		if c.Macvlan != nil {
+			// 子接口在启动时才会创建，这里只检查父网卡
+			if _, err := net.InterfaceByName(c.Macvlan.Parent); err != nil {
+				report(i, c, "macvlan parent %s: %v", c.Macvlan.Parent, err)
+			}
+			check.BindInterface = ""
+		}
+		// 缺少的账号密码已经报告过，填上占位值以便继续检查其他配置
+		if check.Username == "" {
+			check.Username = "-"
+		}
+		if check.Password == "" {
+			check.Password = "-"
+		}
+
+		client, err := NewClient(&check)
+		if err != nil {
+			report(i, c, "%v", err)
+			continue
+		}
+		client.discard()
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%s: %d problem(s) found", path, problems)
+	}
+
+	_, _ = fmt.Fprintf(out, "%s: %d account(s) ok\n", path, len(Configs))
+	return nil
+}
+
+func runValidate() error {
+	return ValidateConfig(configFilePath, os.Stdout)
+}
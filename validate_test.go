@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateConfigDoesNotCreateLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	logDir := filepath.Join(dir, "logs")
+	path := filepath.Join(dir, "config.json")
+	config := `[{"username": "user1", "password": "secret", "log_file": "` + filepath.ToSlash(logDir) + `/{username}.log"}]`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateConfig(path, io.Discard); err != nil {
+		t.Fatalf("ValidateConfig: %v", err)
+	}
+	if _, err := os.Stat(logDir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("config validate created %s: %v", logDir, err)
+	}
+}
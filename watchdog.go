@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"time"
+)
+
+// Watchdog 定期检查每个账号的主循环，卡住超过阈值时输出所有 goroutine 的调用栈并重启该账号
+type Watchdog struct {
+	Timeout time.Duration
+	done    chan struct{}
+	// dumped 记录是否已经输出过调用栈，卡住的原因通常相同，之后只记录重启
+	dumped bool
+}
+
+func StartWatchdog(timeout time.Duration) *Watchdog {
+	w := &Watchdog{Timeout: timeout, done: make(chan struct{})}
+	go w.run()
+	return w
+}
+
+func (w *Watchdog) Stop() {
+	close(w.done)
+}
+
+func (w *Watchdog) run() {
+	ticker := time.NewTicker(w.Timeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			for _, c := range SelectClients("") {
+				reason := c.Stalled(w.Timeout)
+				if reason == "" {
+					continue
+				}
+				c.Log.Printf(T("watchdog: %s, restarting client"), reason)
+				if !w.dumped {
+					w.dumped = true
+					c.Log.Printf(T("watchdog: goroutine dump:\n%s"), goroutineDump())
+				}
+				if err := RestartClient(c); err != nil {
+					c.Log.Printf(T("watchdog: restart failed: %v"), err)
+				}
+			}
+		}
+	}
+}
+
+// Stalled 返回主循环卡住的原因：超过检测间隔加阈值没有处理定时器，或已认证但保活迟迟没有执行
+func (c *Client) Stalled(timeout time.Duration) string {
+	s := c.Status()
+	limit := time.Millisecond*time.Duration(c.Config.CheckInterval) + timeout
+	if !s.LoopTime.IsZero() && time.Since(s.LoopTime) > limit {
+		return fmt.Sprintf("main loop blocked for %v", time.Since(s.LoopTime).Round(time.Second))
+	}
+	if s.Online && !s.NextHeartbeat.IsZero() && time.Since(s.NextHeartbeat) > timeout {
+		return fmt.Sprintf("heartbeat overdue by %v", time.Since(s.NextHeartbeat).Round(time.Second))
+	}
+	return ""
+}
+
+// maxGoroutineDump 是输出的调用栈上限，账号多时完整的调用栈很长，卡住的 goroutine 一般在前面
+const maxGoroutineDump = 64 * 1024
+
+func goroutineDump() []byte {
+	buf := make([]byte, maxGoroutineDump)
+	n := runtime.Stack(buf, true)
+	if n == len(buf) {
+		return append(buf, "\n... truncated"...)
+	}
+	return buf[:n]
+}
+
+// RestartClient 取消卡住的客户端，用同一份配置创建新的客户端替换它。
+// 卡住的 goroutine 无法强制结束，它恢复后不能再发送下线请求：新客户端使用相同的ClientID和地址，
+// 下线会把新客户端刚建立的会话踢掉
+func RestartClient(old *Client) error {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	index := -1
+	for i, c := range clients {
+		if c == old {
+			index = i
+		}
+	}
+	if index < 0 {
+		return errors.New("client already stopped")
+	}
+
+	client, err := NewClient(old.Config)
+	if err != nil {
+		return err
+	}
+	old.abandoned.Store(true)
+	old.Cancel()
+
+	clients[index] = client
+	RunClient(client)
+	log.Printf(T("client %s restarted by watchdog"), old.Config.Username)
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+type countingPortal struct {
+	logouts int
+}
+
+func (p *countingPortal) Auth(string) error { return nil }
+func (p *countingPortal) Heartbeat() error  { return nil }
+func (p *countingPortal) Logout() error {
+	p.logouts++
+	return nil
+}
+
+func TestAbandonedClientSkipsShutdownLogout(t *testing.T) {
+	c := newTestClient(t, &Config{})
+	portal := &countingPortal{}
+	c.portal = portal
+
+	c.shutdownLogout()
+	if portal.logouts != 1 {
+		t.Fatalf("running client sent %d logouts, want 1", portal.logouts)
+	}
+
+	c.abandoned.Store(true)
+	c.shutdownLogout()
+	if portal.logouts != 1 {
+		t.Fatal("client replaced by the watchdog logged out the shared session")
+	}
+}
+
+func TestGoroutineDumpIsCapped(t *testing.T) {
+	if n := len(goroutineDump()); n > maxGoroutineDump+64 {
+		t.Fatalf("goroutine dump is %d bytes, want at most about %d", n, maxGoroutineDump)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"time"
+)
+
+const (
+	ProtocolClient = "client"
+	ProtocolWeb    = "web"
+)
+
+// ErrWebSessionExpired 表示保活请求被门户重定向回登录页，会话Cookie已经失效
+var ErrWebSessionExpired = errors.New("web portal session expired")
+
+// webPortalProfile 是天翼校园网页认证的默认接口，不同学校的路径可以用 web_*_path 覆盖
+var webPortalProfile = CarrierProfile{
+	LoginPath:     "/eportal/login",
+	KeepPath:      "/eportal/keepalive",
+	LogoutPath:    "/eportal/logout",
+	UserParam:     "username",
+	PasswordParam: "password",
+	UserIPParam:   "wlanuserip",
+	AcIPParam:     "wlanacip",
+	AcNameParam:   "wlanacname",
+	SuccessMarks:  []string{"\"result\":\"success\"", "\"result\":0", "login_ok", "认证成功", "登录成功"},
+}
+
+// WebPortal 是 protocol_mode 为 web 时使用的天翼校园网页认证：表单POST登录，之后带着会话Cookie
+// 定期请求保活地址，不需要PC客户端的加密XML协议
+type WebPortal struct {
+	*CarrierPortal
+}
+
+// newESurfingPortal 按 protocol_mode 选择PC客户端协议或网页认证
+func newESurfingPortal(c *Client) Portal {
+	if c.Config.ProtocolMode == ProtocolWeb {
+		return NewWebPortal(c)
+	}
+	return NewESurfing(c)
+}
+
+func NewWebPortal(c *Client) *WebPortal {
+	jar, _ := cookiejar.New(nil)
+	c.HttpClient.Jar = jar
+
+	profile := webPortalProfile
+	if c.Config.WebLoginPath != "" {
+		profile.LoginPath = c.Config.WebLoginPath
+	}
+	if c.Config.WebKeepPath != "" {
+		profile.KeepPath = c.Config.WebKeepPath
+	}
+	if c.Config.WebLogoutPath != "" {
+		profile.LogoutPath = c.Config.WebLogoutPath
+	}
+	return &WebPortal{CarrierPortal: &CarrierPortal{Client: c, profile: &profile}}
+}
+
+func (w *WebPortal) Auth(URL string) error {
+	if err := w.CarrierPortal.Auth(URL); err != nil {
+		return err
+	}
+	w.resetHeartbeat(time.Millisecond * time.Duration(w.Config.HeartbeatInterval))
+	return nil
+}
+
+// Heartbeat 带着登录时得到的Cookie请求保活地址，被重定向或拒绝说明会话已失效
+func (w *WebPortal) Heartbeat() error {
+	if !w.LoggedIn {
+		return errors.New("not logged in")
+	}
+
+	request, err := w.NewGetRequest(w.BaseUrl + w.profile.KeepPath)
+	if err != nil {
+		return err
+	}
+	response, err := w.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+
+	switch {
+	case response.StatusCode == http.StatusOK:
+		return nil
+	case response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden ||
+		(response.StatusCode >= 300 && response.StatusCode < 400):
+		w.LoggedIn = false
+		return ErrWebSessionExpired
+	}
+	return fmt.Errorf("unexpected status code: %d", response.StatusCode)
+}
+
+func (w *WebPortal) Logout() error {
+	err := w.CarrierPortal.Logout()
+	w.HttpClient.Jar, _ = cookiejar.New(nil)
+	return err
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const PortalWISPr = "wispr"
+
+// WISPr 1.0 的消息类型和响应码
+const (
+	wisprMessageRedirect    = 100
+	wisprMessageProxy       = 110
+	wisprMessageLogoffReply = 130
+
+	wisprLoginSucceeded  = 50
+	wisprLoginFailed     = 100
+	wisprRadiusError     = 102
+	wisprNetworkError    = 105
+	wisprLogoffSucceeded = 150
+	wisprAuthPending     = 201
+	wisprGatewayError    = 255
+)
+
+// wisprMaxHops 是跟随 Proxy 消息和轮询认证结果的最大次数
+const wisprMaxHops = 5
+
+// WISPrMessage 是 WISPAccessGatewayParam 中的一条消息(Redirect、Proxy、AuthenticationReply 等)，
+// 各类消息的字段取并集，没有的字段为空
+type WISPrMessage struct {
+	MessageType     int    `xml:"MessageType"`
+	ResponseCode    int    `xml:"ResponseCode"`
+	ReplyMessage    string `xml:"ReplyMessage"`
+	LoginURL        string `xml:"LoginURL"`
+	AbortLoginURL   string `xml:"AbortLoginURL"`
+	NextURL         string `xml:"NextURL"`
+	LoginResultsURL string `xml:"LoginResultsURL"`
+	LogoffURL       string `xml:"LogoffURL"`
+	Delay           int    `xml:"Delay"`
+	LocationName    string `xml:"LocationName"`
+}
+
+type wisprParam struct {
+	Messages []WISPrMessage `xml:",any"`
+}
+
+// ParseWISPr 从门户响应中取出 WISPAccessGatewayParam 块并解析其中的第一条消息。
+// 这个块通常放在HTML注释里，因此先按标签截取再解析
+func ParseWISPr(body []byte) (*WISPrMessage, error) {
+	start := bytes.Index(body, []byte("<WISPAccessGatewayParam"))
+	if start < 0 {
+		return nil, errors.New("no WISPr message in portal response")
+	}
+	end := bytes.Index(body[start:], []byte("</WISPAccessGatewayParam>"))
+	if end < 0 {
+		return nil, errors.New("unterminated WISPr message")
+	}
+	block := body[start : start+end+len("</WISPAccessGatewayParam>")]
+
+	param := &wisprParam{}
+	decoder := xml.NewDecoder(bytes.NewReader(block))
+	decoder.Strict = false
+	if err := decoder.Decode(param); err != nil {
+		return nil, fmt.Errorf("invalid WISPr message: %w", err)
+	}
+	if len(param.Messages) == 0 {
+		return nil, errors.New("empty WISPr message")
+	}
+	message := &param.Messages[0]
+	message.ReplyMessage = strings.TrimSpace(message.ReplyMessage)
+	return message, nil
+}
+
+// WISPrPortal 实现 WISPr 1.0 登录/下线流程，用于公布 WISPr 而不是天翼校园客户端协议的漫游热点
+type WISPrPortal struct {
+	*Client
+
+	LogoffURL string
+}
+
+func NewWISPrPortal(c *Client) *WISPrPortal {
+	return &WISPrPortal{Client: c}
+}
+
+// Auth 优先使用检测时被拦截的响应中的 Redirect 消息，没有时请求门户地址再找
+func (p *WISPrPortal) Auth(redirectURL string) error {
+	message, err := ParseWISPr(p.probeBody)
+	if err != nil {
+		message, err = p.fetch(http.MethodGet, redirectURL, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	for hop := 0; message.MessageType == wisprMessageProxy && hop < wisprMaxHops; hop++ {
+		if message.NextURL == "" {
+			return errors.New("WISPr proxy message without NextURL")
+		}
+		if err = p.checkScheme("NextURL", message.NextURL); err != nil {
+			return err
+		}
+		if message, err = p.fetch(http.MethodGet, message.NextURL, nil); err != nil {
+			return err
+		}
+	}
+	if message.MessageType != wisprMessageRedirect || message.LoginURL == "" {
+		return fmt.Errorf("unexpected WISPr message type %d", message.MessageType)
+	}
+	if err = p.checkScheme("LoginURL", message.LoginURL); err != nil {
+		return err
+	}
+	if message.LocationName != "" {
+		p.Log.Println(T("WISPr location:"), message.LocationName)
+	}
+
+	// WISPr 规定提交明文密码，显式配置了 password_encoding 时才按配置编码
+	password := p.password()
+	if encoding := p.Config.PasswordEncoding; encoding != "" && encoding != PasswordAuto {
+		if password, err = p.portalPassword(redirectURL); err != nil {
+			return err
+		}
+	}
+	form := url.Values{}
+	form.Set("UserName", p.username())
+	form.Set("Password", password)
+	form.Set("button", "Login")
+	form.Set("FNAME", "0")
+	form.Set("OriginatingServer", p.probeURL)
+
+	reply, err := p.fetch(http.MethodPost, message.LoginURL, form)
+	if err != nil {
+		return err
+	}
+	for hop := 0; reply.ResponseCode == wisprAuthPending && hop < wisprMaxHops; hop++ {
+		if reply.LoginResultsURL == "" {
+			return errors.New("WISPr authentication pending without LoginResultsURL")
+		}
+		if err = p.checkScheme("LoginResultsURL", reply.LoginResultsURL); err != nil {
+			return err
+		}
+		if err = p.sleep(time.Duration(min(max(reply.Delay, 1), 30)) * time.Second); err != nil {
+			return err
+		}
+		if reply, err = p.fetch(http.MethodGet, reply.LoginResultsURL, nil); err != nil {
+			return err
+		}
+	}
+
+	if reply.ResponseCode != wisprLoginSucceeded {
+		return wisprError(reply)
+	}
+	p.LogoffURL = reply.LogoffURL
+	return nil
+}
+
+// Heartbeat WISPr 没有保活接口，会话由网关按时长或流量管理
+func (p *WISPrPortal) Heartbeat() error {
+	return nil
+}
+
+func (p *WISPrPortal) Logout() error {
+	if p.LogoffURL == "" {
+		return nil
+	}
+	logoffURL := p.LogoffURL
+	p.LogoffURL = ""
+
+	reply, err := p.fetch(http.MethodGet, logoffURL, nil)
+	if err != nil {
+		return err
+	}
+	if reply.MessageType == wisprMessageLogoffReply && reply.ResponseCode != wisprLogoffSucceeded {
+		return wisprError(reply)
+	}
+	return nil
+}
+
+// checkScheme 拒绝非HTTPS的登录相关地址。这些地址来自被拦截的响应，任何人都能伪造，
+// 而登录地址会收到明文密码，只有配置了 wispr_allow_http 时才允许 http
+func (p *WISPrPortal) checkScheme(name string, URL string) error {
+	u, err := url.Parse(URL)
+	if err != nil {
+		return fmt.Errorf("invalid WISPr %s: %w", name, err)
+	}
+	if u.Scheme != "https" && !p.Config.WISPrAllowHTTP {
+		return fmt.Errorf("WISPr %s %s is not HTTPS, set wispr_allow_http to allow it", name, Redact(URL))
+	}
+	return nil
+}
+
+// fetch 请求WISPr地址并解析响应中的消息。网关常用302返回消息，因此不看状态码
+func (p *WISPrPortal) fetch(method string, URL string, form url.Values) (*WISPrMessage, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	request, err := http.NewRequestWithContext(p.requestContext(), method, URL, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", p.emulation.UserAgent)
+	if form != nil {
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	response, err := p.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	return ParseWISPr(data)
+}
+
+// wisprError 把失败的响应码转为 PortalError，网关的 ReplyMessage 一并带上
+func wisprError(reply *WISPrMessage) error {
+	message := reply.ReplyMessage
+	if message == "" {
+		switch reply.ResponseCode {
+		case wisprLoginFailed:
+			message = "access rejected"
+		case wisprRadiusError:
+			message = "radius server error"
+		case wisprNetworkError:
+			message = "network administrator error"
+		case wisprGatewayError:
+			message = "access gateway internal error"
+		default:
+			message = "unexpected response"
+		}
+	}
+	return &PortalError{Code: "WISPr " + strconv.Itoa(reply.ResponseCode), Message: message}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseWISPr(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    WISPrMessage
+		wantErr bool
+	}{
+		{
+			name: "redirect in html comment",
+			body: `<html><head><!--<?xml version="1.0" encoding="UTF-8"?>
+<WISPAccessGatewayParam xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<Redirect><AccessProcedure>1.0</AccessProcedure><AccessLocation>cafe</AccessLocation><LocationName>Cafe & Co</LocationName>
+<LoginURL>https://gw.example/login?a=1&amp;b=2</LoginURL><AbortLoginURL>https://gw.example/abort</AbortLoginURL>
+<MessageType>100</MessageType><ResponseCode>0</ResponseCode></Redirect>
+</WISPAccessGatewayParam>--></head></html>`,
+			want: WISPrMessage{MessageType: wisprMessageRedirect, LocationName: "Cafe & Co",
+				LoginURL: "https://gw.example/login?a=1&b=2", AbortLoginURL: "https://gw.example/abort"},
+		},
+		{
+			name: "authentication reply",
+			body: `<WISPAccessGatewayParam><AuthenticationReply><MessageType>120</MessageType><ResponseCode>100</ResponseCode>
+<ReplyMessage>
+  Invalid password
+</ReplyMessage></AuthenticationReply></WISPAccessGatewayParam>`,
+			want: WISPrMessage{MessageType: 120, ResponseCode: wisprLoginFailed, ReplyMessage: "Invalid password"},
+		},
+		{
+			name: "proxy",
+			body: `<WISPAccessGatewayParam><Proxy><MessageType>110</MessageType><NextURL>http://gw.example/next</NextURL><Delay>2</Delay></Proxy></WISPAccessGatewayParam>`,
+			want: WISPrMessage{MessageType: wisprMessageProxy, NextURL: "http://gw.example/next", Delay: 2},
+		},
+		{name: "no message", body: "<html>hello</html>", wantErr: true},
+		{name: "unterminated", body: "<WISPAccessGatewayParam><Redirect>", wantErr: true},
+		{name: "empty", body: "<WISPAccessGatewayParam></WISPAccessGatewayParam>", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseWISPr([]byte(test.body))
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("ParseWISPr() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != test.want {
+				t.Errorf("ParseWISPr() = %+v, want %+v", *got, test.want)
+			}
+		})
+	}
+}
+
+func TestWISPrAuthPassword(t *testing.T) {
+	md5sum := md5.Sum([]byte(testPassword))
+	tests := []struct {
+		encoding string
+		want     string
+	}{
+		{"", testPassword},
+		{PasswordAuto, testPassword},
+		{PasswordPlain, testPassword},
+		{PasswordMD5, hex.EncodeToString(md5sum[:])},
+	}
+	for _, test := range tests {
+		t.Run("encoding="+test.encoding, func(t *testing.T) {
+			var posted string
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				posted = r.PostFormValue("Password")
+				_, _ = io.WriteString(w, `<WISPAccessGatewayParam><AuthenticationReply><MessageType>120</MessageType>`+
+					`<ResponseCode>50</ResponseCode><LogoffURL>http://gw.example/logoff</LogoffURL></AuthenticationReply></WISPAccessGatewayParam>`)
+			}))
+			defer server.Close()
+
+			p := NewWISPrPortal(newTestClient(t, &Config{Portal: PortalWISPr, Password: testPassword, PasswordEncoding: test.encoding,
+				TLSInsecureSkipVerify: true}))
+			p.probeURL = "http://detect.example/"
+			p.probeBody = []byte(`<WISPAccessGatewayParam><Redirect><MessageType>100</MessageType><LoginURL>` +
+				server.URL + `/login</LoginURL></Redirect></WISPAccessGatewayParam>`)
+
+			// 挑战值不应影响 WISPr，auto 也提交明文
+			if err := p.Auth(server.URL + "/?challenge=abcdef"); err != nil {
+				t.Fatal(err)
+			}
+			if posted != test.want {
+				t.Errorf("posted password %q, want %q", posted, test.want)
+			}
+			if p.LogoffURL != "http://gw.example/logoff" {
+				t.Errorf("LogoffURL = %q", p.LogoffURL)
+			}
+		})
+	}
+}
+
+func TestWISPrRefusesPlainHTTP(t *testing.T) {
+	var posted bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted = r.PostFormValue("Password") != ""
+		_, _ = io.WriteString(w, `<WISPAccessGatewayParam><AuthenticationReply><MessageType>120</MessageType>`+
+			`<ResponseCode>50</ResponseCode></AuthenticationReply></WISPAccessGatewayParam>`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		probe     string
+		allowHTTP bool
+		wantErr   string
+	}{
+		{name: "login url", probe: `<Redirect><MessageType>100</MessageType><LoginURL>` + server.URL + `/login</LoginURL></Redirect>`,
+			wantErr: "LoginURL"},
+		{name: "next url", probe: `<Proxy><MessageType>110</MessageType><NextURL>` + server.URL + `/next</NextURL></Proxy>`,
+			wantErr: "NextURL"},
+		{name: "allowed", probe: `<Redirect><MessageType>100</MessageType><LoginURL>` + server.URL + `/login</LoginURL></Redirect>`,
+			allowHTTP: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			posted = false
+			p := NewWISPrPortal(newTestClient(t, &Config{Portal: PortalWISPr, WISPrAllowHTTP: test.allowHTTP}))
+			p.probeBody = []byte(`<WISPAccessGatewayParam>` + test.probe + `</WISPAccessGatewayParam>`)
+
+			err := p.Auth(server.URL + "/")
+			if test.wantErr == "" {
+				if err != nil || !posted {
+					t.Fatalf("Auth() = %v, posted %v; want success with wispr_allow_http", err, posted)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Auth() = %v, want an error about %s", err, test.wantErr)
+			}
+			if posted {
+				t.Error("password was posted over plain HTTP")
+			}
+		})
+	}
+}
+
+func TestWISPrRefusesPlainHTTPLoginResults(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `<WISPAccessGatewayParam><AuthenticationReply><MessageType>120</MessageType>`+
+			`<ResponseCode>201</ResponseCode><LoginResultsURL>http://gw.example/results</LoginResultsURL></AuthenticationReply></WISPAccessGatewayParam>`)
+	}))
+	defer server.Close()
+
+	p := NewWISPrPortal(newTestClient(t, &Config{Portal: PortalWISPr, TLSInsecureSkipVerify: true}))
+	p.probeBody = []byte(`<WISPAccessGatewayParam><Redirect><MessageType>100</MessageType><LoginURL>` +
+		server.URL + `/login</LoginURL></Redirect></WISPAccessGatewayParam>`)
+	if err := p.Auth(server.URL + "/"); err == nil || !strings.Contains(err.Error(), "LoginResultsURL") {
+		t.Errorf("Auth() = %v, want an error about LoginResultsURL", err)
+	}
+}
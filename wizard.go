@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// wizardConfig 只写出向导填写过的配置项，其余使用默认值
+type wizardConfig struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	BindInterface string `json:"bind_interface,omitempty"`
+	Portal        string `json:"portal,omitempty"`
+}
+
+// Wizard 交互式生成配置文件
+type Wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func NewWizard(in io.Reader, out io.Writer) *Wizard {
+	return &Wizard{in: bufio.NewReader(in), out: out}
+}
+
+// RunInit 实现 `init` 子命令：选择网卡、探测门户、填写账号后写入校验过的配置文件
+func RunInit(path string) error {
+	return NewWizard(os.Stdin, os.Stdout).Run(path)
+}
+
+func (w *Wizard) Run(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		overwrite, err := w.confirm(fmt.Sprintf(T("%s already exists, overwrite?"), path))
+		if err != nil {
+			return err
+		}
+		if !overwrite {
+			return errors.New("aborted")
+		}
+	}
+
+	config := &Config{}
+
+	iFace, err := w.chooseInterface()
+	if err != nil {
+		return err
+	}
+	config.BindInterface = iFace
+
+	w.printf("%s\n", T("probing for the campus portal..."))
+	portalURL, err := probePortal(config)
+	switch {
+	case err != nil:
+		w.printf(T("probe failed: %v")+"\n", err)
+	case portalURL == "":
+		w.printf("%s\n", T("no portal redirect, the network may already be authenticated"))
+	default:
+		config.Portal = guessPortal(portalURL)
+		w.printf(T("found portal %s (%s)")+"\n", portalURL, config.Portal)
+	}
+
+	for config.Username == "" {
+		if config.Username, err = w.ask(T("username"), ""); err != nil {
+			return err
+		}
+	}
+	for config.Password == "" {
+		if config.Password, err = w.ask(T("password"), ""); err != nil {
+			return err
+		}
+	}
+
+	check := *config
+	client, err := NewClient(&check)
+	if err != nil {
+		return err
+	}
+	client.discard()
+
+	data, err := json.MarshalIndent([]*wizardConfig{{
+		Username:      config.Username,
+		Password:      config.Password,
+		BindInterface: config.BindInterface,
+		Portal:        config.Portal,
+	}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+
+	w.printf(T("config written to %s")+"\n", path)
+	return nil
+}
+
+// chooseInterface 列出可用网卡，直接回车使用系统默认
+func (w *Wizard) chooseInterface() (string, error) {
+	iFaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	defaultIFace, _ := DefaultRouteInterface()
+
+	var names []string
+	for _, iFace := range iFaces {
+		ip, err := GetInterfaceIP(iFace.Name)
+		if err != nil || iFace.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		names = append(names, iFace.Name)
+
+		mark := ""
+		if iFace.Name == defaultIFace {
+			mark = " *"
+		}
+		w.printf("  %d) %s %s%s\n", len(names), iFace.Name, ip, mark)
+	}
+
+	for {
+		answer, err := w.ask(T("interface number, empty for system default"), "")
+		if err != nil {
+			return "", err
+		}
+		if answer == "" {
+			return "", nil
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(names) {
+			return names[n-1], nil
+		}
+		for _, name := range names {
+			if name == answer {
+				return name, nil
+			}
+		}
+	}
+}
+
+// ask 读取一行回答，输入已经结束(如 </dev/null 或管道关闭)时返回错误，由调用方中止向导
+func (w *Wizard) ask(prompt string, def string) (string, error) {
+	if def != "" {
+		w.printf("%s [%s]: ", prompt, def)
+	} else {
+		w.printf("%s: ", prompt)
+	}
+
+	line, err := w.in.ReadString('\n')
+	if err != nil && line == "" {
+		if errors.Is(err, io.EOF) {
+			return "", errors.New("aborted: no more input")
+		}
+		return "", err
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+func (w *Wizard) confirm(prompt string) (bool, error) {
+	answer, err := w.ask(prompt+" (y/N)", "")
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
+
+func (w *Wizard) printf(format string, a ...any) {
+	_, _ = fmt.Fprintf(w.out, format, a...)
+}
+
+// probePortal 请求探测地址，返回门户的重定向地址，已经在线时返回空
+func probePortal(config *Config) (string, error) {
+	probe := *config
+	probe.ConnectTimeout = 5000
+	transport, err := NewHttpTransport(&probe)
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(DetectURL)
+	if err != nil {
+		return "", err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return "", nil
+	case http.StatusFound:
+		return resp.Header.Get("Location"), nil
+	case http.StatusOK:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if err != nil {
+			return "", err
+		}
+		if portalURL := ExtractPortalURL(resp.Request.URL, body); portalURL != "" {
+			return portalURL, nil
+		}
+	}
+	return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+}
+
+// guessPortal 根据重定向地址的特征猜测门户类型
+func guessPortal(portalURL string) string {
+	lower := strings.ToLower(portalURL)
+	switch {
+	case strings.Contains(lower, "srun") || strings.Contains(lower, "ac_id="):
+		return PortalSrun
+	case strings.Contains(lower, "wlanacname=") && strings.Contains(lower, "cmcc"):
+		return PortalCMCC
+	case strings.Contains(lower, "basname=") || strings.Contains(lower, "nasip="):
+		return PortalUnicom
+	}
+	return PortalESurfing
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWizardAsk(t *testing.T) {
+	w := NewWizard(strings.NewReader("alice\n\nbob"), io.Discard)
+	for _, want := range []string{"alice", "default", "bob"} {
+		got, err := w.ask("username", "default")
+		if err != nil || got != want {
+			t.Fatalf("ask() = %q, %v, want %q", got, err, want)
+		}
+	}
+	if _, err := w.ask("username", ""); err == nil {
+		t.Fatal("ask() at end of input returned no error")
+	}
+}
+
+func TestWizardAbortsOnEOF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := NewWizard(strings.NewReader(""), io.Discard).Run(path)
+	if err == nil {
+		t.Fatal("Run() with no input returned no error")
+	}
+	if _, statErr := os.Stat(path); !errors.Is(statErr, os.ErrNotExist) {
+		t.Fatalf("config written after aborted wizard: %v", statErr)
+	}
+}
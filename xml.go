@@ -1,9 +1,11 @@
 package main
 
 import (
-	"context"
 	"encoding/xml"
+	"fmt"
 	"io"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -11,6 +13,11 @@ const (
 	UserAgentAndroid = "CCTP/android64_vpn/2093"
 )
 
+const (
+	TicketMethodPost = "post"
+	TicketMethodGet  = "get"
+)
+
 type TicketRequest struct {
 	XMLName   xml.Name `xml:"request"`
 	Text      string   `xml:",chardata"`
@@ -30,6 +37,16 @@ type TicketResponse struct {
 	Text    string   `xml:",chardata"`
 	Ticket  string   `xml:"ticket"`
 	Expire  string   `xml:"expire"`
+	Code    string   `xml:"code"`
+	Message string   `xml:"message"`
+}
+
+// rejection 返回没有ticket的响应对应的错误：带错误码时是门户的拒绝，否则多半是解密出了无意义的内容
+func (t *TicketResponse) rejection() error {
+	if t.Code != "" || t.Message != "" {
+		return &PortalError{Code: t.Code, Message: t.Message}
+	}
+	return fmt.Errorf("%w: empty ticket in response", ErrAlgoIDRejected)
 }
 
 type LoginRequest struct {
@@ -55,6 +72,8 @@ type LoginResponse struct {
 		AgainstInterval string `xml:"against-interval"`
 	} `xml:"user-config"`
 	DomainConfig string `xml:"domain-config"`
+	Code         string `xml:"code"`
+	Message      string `xml:"message"`
 }
 
 type State struct {
@@ -69,6 +88,8 @@ type State struct {
 	Ipv6      string   `xml:"ipv6"`
 	Mac       string   `xml:"mac"`
 	Ostag     string   `xml:"ostag"`
+	RxBytes   string   `xml:"rx-bytes,omitempty"`
+	TxBytes   string   `xml:"tx-bytes,omitempty"`
 }
 
 type StateResponse struct {
@@ -86,16 +107,16 @@ type EConfig struct {
 	//delete useless field
 }
 
-func (c *Client) GenerateGetTicketXML() ([]byte, error) {
+func (e *ESurfing) GenerateGetTicketXML() ([]byte, error) {
 	tr := TicketRequest{
-		UserAgent: UserAgentAndroid,
-		ClientID:  c.ClientID.String(),
+		UserAgent: e.emulation.UserAgent,
+		ClientID:  e.ClientID.String(),
 		LocalTime: time.Now().Format(time.DateTime),
-		HostName:  c.Hostname,
-		Ipv4:      c.UserIP,
-		Mac:       c.MacAddress,
-		Ostag:     c.Hostname,
-		Gwip:      c.AcIP,
+		HostName:  e.Hostname,
+		Ipv4:      e.UserIP,
+		Mac:       e.MacAddress,
+		Ostag:     e.ostag(),
+		Gwip:      e.AcIP,
 	}
 	out, err := xml.Marshal(tr)
 	if err != nil {
@@ -104,16 +125,23 @@ func (c *Client) GenerateGetTicketXML() ([]byte, error) {
 	return append([]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>"), out...), nil
 }
 
-func (c *Client) GenerateStateXML() ([]byte, error) {
+func (e *ESurfing) GenerateStateXML() ([]byte, error) {
 	s := &State{
-		UserAgent: UserAgentAndroid,
-		ClientID:  c.ClientID.String(),
+		UserAgent: e.emulation.UserAgent,
+		ClientID:  e.ClientID.String(),
 		LocalTime: time.Now().Format(time.DateTime),
-		HostName:  c.Hostname,
-		Ipv4:      c.UserIP,
-		Ticket:    c.Ticket,
-		Mac:       c.MacAddress,
-		Ostag:     c.Hostname,
+		HostName:  e.Hostname,
+		Ipv4:      e.UserIP,
+		Ticket:    e.Ticket,
+		Mac:       e.MacAddress,
+		Ostag:     e.ostag(),
+	}
+	// 部分网关固件要求保活报文带上累计收发字节数，一直为0的会话会被断开
+	if e.Config.KeepTraffic {
+		e.updateTraffic()
+		status := e.Status()
+		s.RxBytes = strconv.FormatUint(status.SessionRxBytes, 10)
+		s.TxBytes = strconv.FormatUint(status.SessionTxBytes, 10)
 	}
 	bytes, err := xml.Marshal(s)
 	if err != nil {
@@ -123,14 +151,19 @@ func (c *Client) GenerateStateXML() ([]byte, error) {
 	return append([]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>"), bytes...), nil
 }
 
-func (c *Client) GenerateLoginXML() ([]byte, error) {
+func (e *ESurfing) GenerateLoginXML() ([]byte, error) {
+	password, err := e.portalPassword(e.RedirectUrl)
+	if err != nil {
+		return nil, err
+	}
+
 	lr := &LoginRequest{
-		UserAgent: UserAgentAndroid,
-		ClientID:  c.ClientID.String(),
-		Ticket:    c.Ticket,
+		UserAgent: e.emulation.UserAgent,
+		ClientID:  e.ClientID.String(),
+		Ticket:    e.Ticket,
 		LocalTime: time.Now().Format(time.DateTime),
-		Userid:    c.Config.Username,
-		Passwd:    c.Config.Password,
+		Userid:    e.username(),
+		Passwd:    password,
 	}
 
 	bytes, err := xml.Marshal(lr)
@@ -141,18 +174,18 @@ func (c *Client) GenerateLoginXML() ([]byte, error) {
 	return append([]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>"), bytes...), nil
 }
 
-func (c *Client) PostXML(url string, data []byte) ([]byte, error) {
-	encXML, err := c.cipher.Encrypt(data)
+func (e *ESurfing) PostXML(url string, data []byte) ([]byte, error) {
+	encXML, err := e.cipher.Encrypt(data)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := c.NewPostRequest(url, encXML)
+	req, err := e.NewPostRequest(url, encXML)
 	if err != nil {
 		return nil, err
 	}
 
-	response, err := c.HttpClient.Do(req)
+	response, err := e.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -165,35 +198,9 @@ func (c *Client) PostXML(url string, data []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	return c.cipher.Decrypt(data)
-}
-
-func (c *Client) PostXMLWithTimeout(url string, data []byte) ([]byte, error) {
-	//set timeout 1s to ensure program not blocking after ctrl+c
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second*3))
-	defer cancel()
-	encXML, err := c.cipher.Encrypt(data)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := c.NewPostRequestWithCustomCtx(ctx, url, encXML)
-	if err != nil {
-		return nil, err
-	}
-
-	response, err := c.HttpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer func(Body io.ReadCloser) {
-		_ = Body.Close()
-	}(response.Body)
-
-	data, err = io.ReadAll(response.Body)
-	if err != nil {
-		return nil, err
+	// 较新的网关可能直接返回未加密的 JSON
+	if strings.Contains(response.Header.Get("Content-Type"), "json") && isJSON(data) {
+		return data, nil
 	}
-
-	return c.cipher.Decrypt(data)
+	return decryptResponse(e.cipher, data)
 }
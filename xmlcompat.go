@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// xmlFieldAliases 是不同版本AC固件对同一字段使用过的其他元素名，按顺序匹配
+var xmlFieldAliases = map[string][]string{
+	"ticket":     {"token", "user-ticket"},
+	"keep-url":   {"keepurl", "keep_url", "keepalive-url", "heartbeat-url"},
+	"term-url":   {"termurl", "term_url", "logout-url", "offline-url"},
+	"keep-retry": {"keepretry", "keep_retry", "keep-interval", "interval"},
+	"interval":   {"keep-retry", "keep-interval", "heartbeat-interval"},
+	"ticket-url": {"ticketurl", "ticket_url"},
+	"auth-url":   {"authurl", "auth_url", "login-url"},
+	"code":       {"result", "error-code", "errcode", "rescode"},
+	"message":    {"msg", "error", "errmsg", "description", "resinfo"},
+}
+
+// decodePortalResponse 宽松地解析门户的响应。较新的网关返回 JSON，其余按 XML 解析：不校验根元素名和大小写，
+// 允许未转义的 & 和未声明的编码。字段找不到时依次尝试 xmlFieldAliases 和配置的 xml_field_aliases 中的其他名称
+func (c *Client) decodePortalResponse(data []byte, v any) error {
+	var values map[string]string
+	var err error
+	if isJSON(data) {
+		values, err = flattenJSON(data)
+	} else {
+		values, err = flattenXML(data)
+	}
+	if err != nil {
+		return err
+	}
+
+	target := reflect.ValueOf(v).Elem()
+	fillXMLFields(target, values, c.Config.XMLFieldAliases)
+	return nil
+}
+
+// 门户响应只有两三层、十几个元素，超过这些限制的文档直接拒绝，避免被冒充的网关用超深或超大的文档耗尽资源
+const (
+	maxXMLDepth    = 32
+	maxXMLElements = 4096
+)
+
+var ErrResponseTooComplex = errors.New("portal response nested too deep or has too many elements")
+
+// flattenXML 把 XML 中所有叶子元素展开为 小写元素名 -> 文本，同名元素取第一个
+func flattenXML(data []byte) (map[string]string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	values := map[string]string{}
+	var stack []string
+	var text strings.Builder
+	elements := 0
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, strings.ToLower(t.Name.Local))
+			text.Reset()
+			elements++
+			if len(stack) > maxXMLDepth || elements > maxXMLElements {
+				return nil, ErrResponseTooComplex
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			name := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if _, ok := values[name]; !ok {
+				values[name] = strings.TrimSpace(text.String())
+			}
+			text.Reset()
+		}
+	}
+
+	if elements == 0 {
+		return nil, errors.New("invalid xml response")
+	}
+	return values, nil
+}
+
+func isJSON(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '{'
+}
+
+// flattenJSON 把 JSON 对象中所有非对象的值展开为 小写键名 -> 文本，键名中的下划线视为连字符，
+// 这样 keep_url、keepUrl 一类的写法也能对应到 XML 的字段名
+func flattenJSON(data []byte) (map[string]string, error) {
+	var root map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&root); err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	var walk func(object map[string]any, depth int) error
+	walk = func(object map[string]any, depth int) error {
+		if depth > maxXMLDepth || len(values) > maxXMLElements {
+			return ErrResponseTooComplex
+		}
+		for key, value := range object {
+			if nested, ok := value.(map[string]any); ok {
+				if err := walk(nested, depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+			text := ""
+			switch v := value.(type) {
+			case nil:
+				continue
+			case string:
+				text = v
+			default:
+				text = fmt.Sprint(v)
+			}
+			for _, name := range jsonKeyNames(key) {
+				if _, ok := values[name]; !ok {
+					values[name] = strings.TrimSpace(text)
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(root, 1); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// jsonKeyNames 返回 JSON 键名对应的 XML 风格名称，如 keepUrl、keep_url 都对应 keep-url
+func jsonKeyNames(key string) []string {
+	var hyphenated strings.Builder
+	for i, r := range key {
+		if r == '_' {
+			r = '-'
+		} else if unicode.IsUpper(r) && i > 0 && key[i-1] != '_' && key[i-1] != '-' {
+			hyphenated.WriteByte('-')
+		}
+		hyphenated.WriteRune(unicode.ToLower(r))
+	}
+	return []string{strings.ToLower(key), hyphenated.String()}
+}
+
+func fillXMLFields(target reflect.Value, values map[string]string, extra map[string][]string) {
+	for i := 0; i < target.NumField(); i++ {
+		field := target.Field(i)
+		name, _, _ := strings.Cut(target.Type().Field(i).Tag.Get("xml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		if field.Kind() == reflect.Struct {
+			fillXMLFields(field, values, extra)
+			continue
+		}
+		if field.Kind() != reflect.String {
+			continue
+		}
+
+		names := append([]string{name}, xmlFieldAliases[name]...)
+		names = append(names, extra[name]...)
+		for _, n := range names {
+			if value, ok := values[strings.ToLower(n)]; ok && value != "" {
+				field.SetString(value)
+				break
+			}
+		}
+	}
+}